@@ -3,10 +3,16 @@ package main
 import (
 	"fmt"
 	"os"
-	"path/filepath"
-	"time"
 )
 
+const usage = `usage:
+  flit new [-seq] [-template FILE] MIGRATION-DIR [DESCRIPTION...]
+  flit migrate -dsn DSN -dir MIGRATION-DIR [-driver mysql|sqlite3|postgres] [-glob GLOB] [-guard GUARD] [-lock-name NAME]
+  flit status -dsn DSN -dir MIGRATION-DIR [-driver mysql|sqlite3|postgres] [-glob GLOB] [-guard GUARD] [-lock-name NAME] [-json]
+  flit verify -dsn DSN -dir MIGRATION-DIR [-driver mysql|sqlite3|postgres] [-glob GLOB] [-guard GUARD] [-lock-name NAME]
+  flit rollback -dsn DSN -dir MIGRATION-DIR [-driver mysql|sqlite3|postgres] [-glob GLOB] [-guard GUARD] [-lock-name NAME] [-steps N]
+  flit redo -dsn DSN -dir MIGRATION-DIR [-driver mysql|sqlite3|postgres] [-glob GLOB] [-guard GUARD] [-lock-name NAME]`
+
 func main() {
 	if err := run(); err != nil {
 		fmt.Fprintf(os.Stderr, "flit: %v\n", err)
@@ -15,28 +21,31 @@ func main() {
 }
 
 func run() error {
-	if len(os.Args) != 3 || os.Args[1] != "new" {
-		fmt.Fprintln(os.Stderr, "usage: flit new MIGRATION-DIR")
-		os.Exit(2)
-	}
-
-	dir := os.Args[2]
-	di, err := os.Stat(dir)
-	if err != nil {
-		return err
+	if len(os.Args) < 2 {
+		exitUsage()
 	}
 
-	if !di.IsDir() {
-		return fmt.Errorf("stat %s: not a directory", dir)
+	switch os.Args[1] {
+	case "new":
+		return runNew(os.Args[2:])
+	case "migrate":
+		return runMigrate(os.Args[2:])
+	case "status":
+		return runStatus(os.Args[2:])
+	case "verify":
+		return runVerify(os.Args[2:])
+	case "rollback":
+		return runRollback(os.Args[2:])
+	case "redo":
+		return runRedo(os.Args[2:])
 	}
 
-	name := fmt.Sprintf("%s-new-migration.sql", time.Now().Format("20060102150405"))
-	path := filepath.Join(dir, name)
-
-	if err := os.WriteFile(path, nil, 0644); err != nil {
-		return err
-	}
+	exitUsage()
+	return nil
+}
 
-	_, err = fmt.Println(path)
-	return err
+// exitUsage prints the usage message and exits with status 2.
+func exitUsage() {
+	fmt.Fprintln(os.Stderr, usage)
+	os.Exit(2)
 }
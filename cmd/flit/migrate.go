@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+
+	"github.com/180-studios/flit"
+
+	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// dbFlags are the flags shared by commands that connect to a database.
+type dbFlags struct {
+	dsn      string
+	dir      string
+	driver   string
+	glob     string
+	guard    string
+	lockName string
+}
+
+func (f *dbFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.dsn, "dsn", "", "database `DSN`")
+	fs.StringVar(&f.dir, "dir", "", "migration `directory`")
+	fs.StringVar(&f.driver, "driver", "mysql", "database `driver`: mysql, sqlite3, or postgres")
+	fs.StringVar(&f.glob, "glob", "*.sql", "`pattern` of migration files in the directory")
+	fs.StringVar(&f.guard, "guard", "", "`guard`: mutex, mysql, postgres, or sqlite (default: the driver's)")
+	fs.StringVar(&f.lockName, "lock-name", "", "`name` of the lock taken by the mysql guard (default: flit)")
+}
+
+// guardDrivers maps each guard to the driver it requires, or "" if it works with any driver.
+var guardDrivers = map[string]string{
+	"mutex":    "",
+	"mysql":    "mysql",
+	"postgres": "postgres",
+	"sqlite":   "sqlite3",
+}
+
+// guardFunc returns the guard selected by the flags.
+// The default guard is the one for the driver.
+func (f *dbFlags) guardFunc() (flit.GuardFunc, error) {
+	guard := f.guard
+	if guard == "" {
+		guard = map[string]string{"mysql": "mysql", "postgres": "postgres", "sqlite3": "sqlite"}[f.driver]
+	}
+
+	driver, ok := guardDrivers[guard]
+	switch {
+	case !ok:
+		return nil, fmt.Errorf("unsupported guard %q", guard)
+	case driver != "" && driver != f.driver:
+		return nil, fmt.Errorf("the %s guard can't be used with the %s driver", guard, f.driver)
+	case f.lockName != "" && guard != "mysql":
+		return nil, fmt.Errorf("-lock-name is only supported by the mysql guard")
+	}
+
+	switch guard {
+	case "mutex":
+		return flit.GuardMutex(), nil
+	case "mysql":
+		if f.lockName != "" {
+			return flit.GuardMySQLNamed(f.lockName), nil
+		}
+
+		return flit.GuardMySQL, nil
+	case "postgres":
+		return flit.GuardPostgres, nil
+	default:
+		return flit.GuardSQLite, nil
+	}
+}
+
+// open connects to the database and creates a migrator with the selected guard.
+// The caller must close the database.
+func (f *dbFlags) open() (*sql.DB, *flit.Migrator, error) {
+	if f.dsn == "" || f.dir == "" {
+		return nil, nil, fmt.Errorf("-dsn and -dir are required")
+	}
+
+	if !slices.Contains([]string{"mysql", "postgres", "sqlite3"}, f.driver) {
+		return nil, nil, fmt.Errorf("unsupported driver %q", f.driver)
+	}
+
+	guard, err := f.guardFunc()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	db, err := sql.Open(f.driver, f.dsn)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	m := flit.New(db, os.DirFS(f.dir), flit.WithGlob(f.glob), flit.WithGuard(guard))
+	return db, m, nil
+}
+
+// parseFlags parses the command's arguments, exiting with the usage message if they are invalid.
+func parseFlags(fs *flag.FlagSet, args []string) {
+	fs.Usage = exitUsage
+	if err := fs.Parse(args); err != nil || fs.NArg() != 0 {
+		exitUsage()
+	}
+}
+
+func runMigrate(args []string) error {
+	var f dbFlags
+	fs := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	f.register(fs)
+	parseFlags(fs, args)
+
+	db, m, err := f.open()
+	if err != nil {
+		return err
+	}
+
+	defer db.Close()
+
+	result, err := m.MigrateResult(context.Background())
+	for _, a := range result.Applied {
+		fmt.Println(a.Name)
+	}
+
+	if err == nil {
+		fmt.Fprintf(os.Stderr, "%d applied, %d already up to date\n", len(result.Applied), result.UpToDate)
+	}
+
+	return err
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// seqPattern matches the numeric prefix of a migration file name.
+var seqPattern = regexp.MustCompile(`^(\d+)[-_]`)
+
+// slugPattern matches runs of characters that are replaced with a hyphen in descriptions.
+var slugPattern = regexp.MustCompile(`[^a-z0-9]+`)
+
+func runNew(args []string) error {
+	var (
+		seq      bool
+		template string
+	)
+
+	fs := flag.NewFlagSet("new", flag.ContinueOnError)
+	fs.BoolVar(&seq, "seq", false, "prefix the file with the next sequence number instead of a timestamp")
+	fs.StringVar(&template, "template", "", "copy the content of `file` into the new file instead of the default header and sections")
+	fs.Usage = exitUsage
+	if err := fs.Parse(args); err != nil || fs.NArg() < 1 {
+		exitUsage()
+	}
+
+	dir := fs.Arg(0)
+	di, err := os.Stat(dir)
+	if err != nil {
+		return err
+	}
+
+	if !di.IsDir() {
+		return fmt.Errorf("stat %s: not a directory", dir)
+	}
+
+	description := slugPattern.ReplaceAllString(strings.ToLower(strings.Join(fs.Args()[1:], " ")), "-")
+	description = strings.Trim(description, "-")
+	if description == "" {
+		description = "new-migration"
+	}
+
+	now := time.Now()
+	prefix := now.Format("20060102150405")
+	if seq {
+		if prefix, err = nextSeq(dir); err != nil {
+			return err
+		}
+	}
+
+	name := fmt.Sprintf("%s-%s.sql", prefix, description)
+	path := filepath.Join(dir, name)
+
+	content := fmt.Appendf(nil, "-- %s\n-- Created %s\n\n-- +flit Up\n\n\n-- +flit Down\n\n", name, now.UTC().Format(time.RFC3339))
+	if template != "" {
+		if content, err = os.ReadFile(template); err != nil {
+			return err
+		}
+	}
+
+	if err := os.WriteFile(path, content, 0644); err != nil {
+		return err
+	}
+
+	_, err = fmt.Println(path)
+	return err
+}
+
+// nextSeq returns the sequence number following the largest numeric prefix of the files in dir,
+// zero-padded to the width of that prefix.
+// If there are no numbered files, it returns "0001".
+func nextSeq(dir string) (string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", err
+	}
+
+	var last uint64
+	width := 4
+	for _, e := range entries {
+		match := seqPattern.FindStringSubmatch(e.Name())
+		if match == nil {
+			continue
+		}
+
+		n, err := strconv.ParseUint(match[1], 10, 64)
+		if err != nil {
+			return "", fmt.Errorf("parse sequence number of %s: %w", e.Name(), err)
+		}
+
+		if n >= last {
+			last, width = n, len(match[1])
+		}
+	}
+
+	return fmt.Sprintf("%0*d", width, last+1), nil
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"context"
+	"flag"
+)
+
+func runRedo(args []string) error {
+	var f dbFlags
+	fs := flag.NewFlagSet("redo", flag.ContinueOnError)
+	f.register(fs)
+	parseFlags(fs, args)
+
+	db, m, err := f.open()
+	if err != nil {
+		return err
+	}
+
+	defer db.Close()
+
+	return m.Redo(context.Background())
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+)
+
+func runRollback(args []string) error {
+	var f dbFlags
+	fs := flag.NewFlagSet("rollback", flag.ContinueOnError)
+	f.register(fs)
+	steps := fs.Int("steps", 1, "`number` of migrations to roll back")
+	parseFlags(fs, args)
+
+	db, m, err := f.open()
+	if err != nil {
+		return err
+	}
+
+	defer db.Close()
+
+	rolledBack, err := m.Rollback(context.Background(), *steps)
+	for _, name := range rolledBack {
+		fmt.Println(name)
+	}
+
+	return err
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+)
+
+// A statusRow describes one migration in the output of flit status.
+type statusRow struct {
+	Name      string     `json:"name,omitempty"`
+	Sum       string     `json:"sum,omitempty"`
+	State     string     `json:"state"`
+	AppliedAt *time.Time `json:"applied_at,omitempty"`
+}
+
+func runStatus(args []string) error {
+	var (
+		f        dbFlags
+		jsonFlag bool
+	)
+
+	fs := flag.NewFlagSet("status", flag.ContinueOnError)
+	f.register(fs)
+	fs.BoolVar(&jsonFlag, "json", false, "print JSON")
+	parseFlags(fs, args)
+
+	db, m, err := f.open()
+	if err != nil {
+		return err
+	}
+
+	defer db.Close()
+
+	status, err := m.Status(context.Background())
+	if err != nil {
+		return err
+	}
+
+	rows := []statusRow{}
+	for _, name := range status.Applied {
+		row := statusRow{Name: name, State: "applied"}
+		if t, ok := status.AppliedAt[name]; ok {
+			row.AppliedAt = &t
+		}
+
+		rows = append(rows, row)
+	}
+
+	for _, name := range status.Dirty {
+		rows = append(rows, statusRow{Name: name, State: "dirty"})
+	}
+
+	for _, name := range status.Pending {
+		rows = append(rows, statusRow{Name: name, State: "pending"})
+	}
+
+	for _, sum := range status.Orphans {
+		rows = append(rows, statusRow{Sum: sum, State: "orphaned"})
+	}
+
+	if jsonFlag {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(rows)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "MIGRATION\tSTATE\tAPPLIED AT")
+	for _, row := range rows {
+		name, appliedAt := row.Name, ""
+		if name == "" {
+			name = row.Sum
+		}
+
+		if row.AppliedAt != nil {
+			appliedAt = row.AppliedAt.Format(time.RFC3339)
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%s\n", name, row.State, appliedAt)
+	}
+
+	return w.Flush()
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+)
+
+func runVerify(args []string) error {
+	var f dbFlags
+	fs := flag.NewFlagSet("verify", flag.ContinueOnError)
+	f.register(fs)
+	parseFlags(fs, args)
+
+	db, m, err := f.open()
+	if err != nil {
+		return err
+	}
+
+	defer db.Close()
+
+	if err := m.Verify(context.Background()); err != nil {
+		return err
+	}
+
+	fmt.Println("database matches migrations")
+	return nil
+}
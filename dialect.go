@@ -0,0 +1,160 @@
+package flit
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// A Dialect describes the SQL syntax used by a database.
+// Pass a [WithDialect] option to [New] to configure it.
+type Dialect int
+
+const (
+	// DialectDefault uses "?" placeholders, as MySQL and SQLite do.
+	DialectDefault Dialect = iota
+
+	// DialectPostgres uses "$1" placeholders, as PostgreSQL does.
+	DialectPostgres
+
+	// DialectMSSQL uses "@p1" placeholders, as SQL Server does,
+	// and T-SQL types and syntax for Flit's table.
+	DialectMSSQL
+)
+
+// placeholder returns the placeholder for the nth (1-based) argument of a statement.
+func (d Dialect) placeholder(n int) string {
+	switch d {
+	case DialectPostgres:
+		return "$" + strconv.Itoa(n)
+	case DialectMSSQL:
+		return "@p" + strconv.Itoa(n)
+	}
+
+	return "?"
+}
+
+// quote quotes an identifier, such as a table name, so it keeps its case and can be a reserved word.
+// The default dialect quotes with backticks, which MySQL and SQLite both accept,
+// [DialectPostgres] quotes with double quotes, and [DialectMSSQL] quotes with brackets.
+// A closing quote character in the identifier is escaped by doubling it.
+func (d Dialect) quote(identifier string) string {
+	open, close := "`", "`"
+	switch d {
+	case DialectPostgres:
+		open, close = `"`, `"`
+	case DialectMSSQL:
+		open, close = "[", "]"
+	}
+
+	return open + strings.ReplaceAll(identifier, close, close+close) + close
+}
+
+// boolean returns the literal for b.
+// SQL Server has no boolean literals, so [DialectMSSQL] uses 1 and 0.
+func (d Dialect) boolean(b bool) string {
+	switch {
+	case d == DialectMSSQL && b:
+		return "1"
+	case d == DialectMSSQL:
+		return "0"
+	case b:
+		return "TRUE"
+	}
+
+	return "FALSE"
+}
+
+// booleanType returns the column type for boolean values.
+func (d Dialect) booleanType() string {
+	if d == DialectMSSQL {
+		return "BIT"
+	}
+
+	return "BOOLEAN"
+}
+
+// timestampType returns the column type for timestamps.
+// SQL Server's TIMESTAMP is a row version rather than a date and time, so [DialectMSSQL] uses DATETIME2.
+func (d Dialect) timestampType() string {
+	if d == DialectMSSQL {
+		return "DATETIME2"
+	}
+
+	return "TIMESTAMP"
+}
+
+// textType returns the column type for text of any length.
+func (d Dialect) textType() string {
+	if d == DialectMSSQL {
+		return "NVARCHAR(MAX)"
+	}
+
+	return "TEXT"
+}
+
+// createTable returns a statement, and its arguments, that creates the quoted table with the given column definitions
+// unless it already exists.
+// SQL Server doesn't support CREATE TABLE IF NOT EXISTS, so [DialectMSSQL] checks OBJECT_ID instead.
+func (d Dialect) createTable(table, definitions string) (string, []any) {
+	if d == DialectMSSQL {
+		return "IF OBJECT_ID(" + d.placeholder(1) + ", N'U') IS NULL CREATE TABLE " + table + " (" + definitions + ")", []any{table}
+	}
+
+	return "CREATE TABLE IF NOT EXISTS " + table + " (" + definitions + ")", nil
+}
+
+// addColumn returns a statement that adds a column to the quoted table.
+func (d Dialect) addColumn(table, name, definition string) string {
+	if d == DialectMSSQL {
+		return "ALTER TABLE " + table + " ADD " + name + " " + definition
+	}
+
+	return "ALTER TABLE " + table + " ADD COLUMN " + name + " " + definition
+}
+
+// placeholders returns a comma-separated list of placeholders for n arguments.
+func (d Dialect) placeholders(n int) string {
+	ps := make([]string, n)
+	for i := range ps {
+		ps[i] = d.placeholder(i + 1)
+	}
+
+	return strings.Join(ps, ", ")
+}
+
+// detectDialect returns the dialect used by the database's driver.
+// It recognizes the github.com/lib/pq and github.com/jackc/pgx drivers for PostgreSQL,
+// the github.com/microsoft/go-mssqldb and github.com/denisenkom/go-mssqldb drivers for SQL Server,
+// and returns [DialectDefault] for any other driver,
+// or if the database doesn't expose its driver as [*sql.DB] does.
+func detectDialect(db DB) Dialect {
+	d, ok := db.(interface{ Driver() driver.Driver })
+	if !ok || d == (*sql.DB)(nil) {
+		return DialectDefault
+	}
+
+	t := reflect.TypeOf(d.Driver())
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch path := t.PkgPath(); {
+	case strings.HasPrefix(path, "github.com/lib/pq"), strings.HasPrefix(path, "github.com/jackc/pgx"):
+		return DialectPostgres
+	case strings.HasPrefix(path, "github.com/microsoft/go-mssqldb"), strings.HasPrefix(path, "github.com/denisenkom/go-mssqldb"):
+		return DialectMSSQL
+	}
+
+	return DialectDefault
+}
+
+// WithDialect configures Flit to use the SQL syntax of the given dialect.
+// By default the dialect is detected from the database's driver.
+func WithDialect(d Dialect) ConfigOption {
+	return func(c *Migrator) {
+		c.dialect = d
+	}
+}
@@ -2,15 +2,32 @@ package flit_test
 
 import (
 	"context"
+	"crypto/md5"
+	"crypto/sha256"
 	"database/sql"
+	"database/sql/driver"
+	"embed"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
 	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"testing/fstest"
+	"time"
 
 	"github.com/180-studios/flit"
 	"github.com/180-studios/flit/mysqltest"
+	"github.com/180-studios/flit/postgrestest"
 	"github.com/180-studios/flit/sqlitetest"
 	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
 
 	_ "github.com/go-sql-driver/mysql"
 	_ "github.com/mattn/go-sqlite3"
@@ -34,6 +51,73 @@ func ExampleMigrator() {
 	// Output: [001-first.sql 002-second.sql]
 }
 
+// migrations are the example migrations embedded in the test binary.
+//
+//go:embed testdata/example/*.sql
+var migrations embed.FS
+
+func ExampleMigrator_embed() {
+	db, err := sql.Open("sqlite3", "file:example_embed?mode=memory&cache=shared")
+	if err != nil {
+		panic(err)
+	}
+
+	defer db.Close()
+
+	// name the migrations relative to their directory, as os.DirFS does
+	fsys, err := fs.Sub(migrations, "testdata/example")
+	if err != nil {
+		panic(err)
+	}
+
+	m := flit.New(db, fsys)
+	applied, err := m.Migrate(context.Background())
+	if err != nil {
+		panic(err)
+	}
+
+	fmt.Println(applied)
+	// Output: [001-first.sql 002-second.sql]
+}
+
+func ExampleRun() {
+	db, err := sql.Open("sqlite3", "file:example_run?mode=memory&cache=shared")
+	if err != nil {
+		panic(err)
+	}
+
+	defer db.Close()
+
+	applied, err := flit.Run(context.Background(), db, os.DirFS("testdata/example"))
+	if err != nil {
+		panic(err)
+	}
+
+	fmt.Println(applied)
+	// Output: [001-first.sql 002-second.sql]
+}
+
+func TestEmbedMatchesDirFS(t *testing.T) {
+	db := sqlitetest.NewDB(t)
+	if _, err := flit.New(db, os.DirFS("testdata/example")).Migrate(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+
+	fsys, err := fs.Sub(migrations, "testdata/example")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	status, err := flit.New(db, fsys).Status(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(status.Pending) != 0 || len(status.Orphans) != 0 {
+		t.Errorf("expected the embedded migrations to match the applied ones, got %+v", status)
+	}
+}
+
 func TestMySQL(t *testing.T) {
 	dsn, ok := os.LookupEnv("TEST_MYSQL_DSN")
 	if !ok {
@@ -52,6 +136,302 @@ func TestMySQL(t *testing.T) {
 	}
 }
 
+func TestMySQLAppliedAtUpgrade(t *testing.T) {
+	dsn, ok := os.LookupEnv("TEST_MYSQL_DSN")
+	if !ok {
+		t.Skip("TEST_MYSQL_DSN is not set")
+	}
+
+	db := mysqltest.NewDB(t, dsn)
+
+	// a table created by an older version of flit
+	if _, err := db.Exec("CREATE TABLE flits (sum CHAR(64) PRIMARY KEY)"); err != nil {
+		t.Fatal(err)
+	}
+
+	m := flit.New(db, os.DirFS("testdata/example"), flit.WithGuard(flit.GuardMySQL))
+	if _, err := m.Migrate(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+
+	var nullable, extra string
+	if err := db.QueryRow("SELECT IS_NULLABLE, EXTRA FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'flits' AND COLUMN_NAME = 'applied_at'").Scan(&nullable, &extra); err != nil {
+		t.Fatal(err)
+	}
+
+	if nullable != "YES" || strings.Contains(strings.ToLower(extra), "on update") {
+		t.Errorf("expected a nullable applied_at column that isn't updated automatically, got IS_NULLABLE %s and EXTRA %q", nullable, extra)
+	}
+}
+
+func TestGuardMySQLNamed(t *testing.T) {
+	f := func(context.Context, *sql.Conn) error {
+		t.Error("expected f not to be called")
+		return nil
+	}
+
+	for _, name := range []string{"", strings.Repeat("x", 65)} {
+		if err := flit.GuardMySQLNamed(name)(t.Context(), nil, f); err == nil {
+			t.Errorf("expected an error for lock name %q", name)
+		}
+	}
+
+	dsn, ok := os.LookupEnv("TEST_MYSQL_DSN")
+	if !ok {
+		t.Skip("TEST_MYSQL_DSN is not set")
+	}
+
+	db := mysqltest.NewDB(t, dsn)
+	m := flit.New(db, os.DirFS("testdata/example"), flit.WithGuard(flit.GuardMySQLNamed("it's flit")))
+	if _, err := m.Migrate(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGuardMySQLNegativeTimeout(t *testing.T) {
+	err := flit.GuardMySQLTimeout(-time.Second)(t.Context(), nil, func(context.Context, *sql.Conn) error {
+		t.Error("expected f not to be called")
+		return nil
+	})
+
+	if err == nil || !strings.Contains(err.Error(), "must not be negative") {
+		t.Errorf("expected an error for the negative timeout, got %v", err)
+	}
+}
+
+func TestGuardMySQLTimeout(t *testing.T) {
+	dsn, ok := os.LookupEnv("TEST_MYSQL_DSN")
+	if !ok {
+		t.Skip("TEST_MYSQL_DSN is not set")
+	}
+
+	db := mysqltest.NewDB(t, dsn)
+	holder, err := db.Conn(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer holder.Close()
+
+	err = flit.GuardMySQL(t.Context(), holder, func(ctx context.Context, _ *sql.Conn) error {
+		conn, err := db.Conn(ctx)
+		if err != nil {
+			return err
+		}
+
+		defer conn.Close()
+
+		return flit.GuardMySQLTimeout(time.Second)(ctx, conn, func(context.Context, *sql.Conn) error {
+			t.Error("expected f not to be called while the lock is held")
+			return nil
+		})
+	})
+
+	if !errors.Is(err, flit.ErrLockBusy) || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("expected a timeout error, got %v", err)
+	}
+}
+
+func TestGuardMySQLTryLock(t *testing.T) {
+	dsn, ok := os.LookupEnv("TEST_MYSQL_DSN")
+	if !ok {
+		t.Skip("TEST_MYSQL_DSN is not set")
+	}
+
+	db := mysqltest.NewDB(t, dsn)
+	holder, err := db.Conn(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer holder.Close()
+
+	err = flit.GuardMySQL(t.Context(), holder, func(ctx context.Context, _ *sql.Conn) error {
+		m := flit.New(db, os.DirFS("testdata/example"), flit.WithGuard(flit.GuardMySQLTryLock()))
+		_, err := m.Migrate(ctx)
+		return err
+	})
+
+	if !errors.Is(err, flit.ErrLockBusy) {
+		t.Errorf("expected ErrLockBusy, got %v", err)
+	}
+}
+
+func TestGuardMySQLRelease(t *testing.T) {
+	dsn, ok := os.LookupEnv("TEST_MYSQL_DSN")
+	if !ok {
+		t.Skip("TEST_MYSQL_DSN is not set")
+	}
+
+	db := mysqltest.NewDB(t, dsn)
+	conn, err := db.Conn(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer conn.Close()
+
+	// release the lock early, so the guard no longer holds it
+	err = flit.GuardMySQL(t.Context(), conn, func(ctx context.Context, conn *sql.Conn) error {
+		_, err := conn.ExecContext(ctx, "SELECT RELEASE_LOCK('flit')")
+		return err
+	})
+
+	if err == nil || !strings.Contains(err.Error(), "not held") {
+		t.Errorf("expected a release error, got %v", err)
+	}
+}
+
+func TestGuardMySQLCancelled(t *testing.T) {
+	dsn, ok := os.LookupEnv("TEST_MYSQL_DSN")
+	if !ok {
+		t.Skip("TEST_MYSQL_DSN is not set")
+	}
+
+	db := mysqltest.NewDB(t, dsn)
+	ctx, cancel := context.WithCancel(t.Context())
+	err := flit.GuardMySQL(ctx, mustConn(t, db), func(ctx context.Context, _ *sql.Conn) error {
+		cancel()
+		return ctx.Err()
+	})
+
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected the guard to be cancelled, got %v", err)
+	}
+
+	// the lock was released, so another session can acquire it without waiting
+	err = flit.GuardMySQLTryLock()(t.Context(), mustConn(t, db), func(context.Context, *sql.Conn) error {
+		return nil
+	})
+
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+// mustConn acquires a connection from db that is closed after the test.
+func mustConn(t *testing.T, db *sql.DB) *sql.Conn {
+	t.Helper()
+	conn, err := db.Conn(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		conn.Close()
+	})
+
+	return conn
+}
+
+func TestGuardMSSQLNamed(t *testing.T) {
+	f := func(context.Context, *sql.Conn) error {
+		t.Error("expected f not to be called")
+		return nil
+	}
+
+	for _, name := range []string{"", strings.Repeat("x", 256)} {
+		if err := flit.GuardMSSQLNamed(name)(t.Context(), nil, f); err == nil {
+			t.Errorf("expected an error for resource name %q", name)
+		}
+	}
+}
+
+func TestPostgres(t *testing.T) {
+	dsn, ok := os.LookupEnv("TEST_POSTGRES_DSN")
+	if !ok {
+		t.Skip("TEST_POSTGRES_DSN is not set")
+	}
+
+	db := postgrestest.NewDB(t, dsn)
+	m := flit.New(db, os.DirFS("testdata/example"), flit.WithGuard(flit.GuardPostgres))
+	applied, err := m.Migrate(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := cmp.Diff([]string{"001-first.sql", "002-second.sql"}, applied); diff != "" {
+		t.Errorf("applied migrations differ (-want +got):\n%s", diff)
+	}
+
+	rolledBack, err := m.Rollback(t.Context(), 1)
+	if err == nil || len(rolledBack) != 0 {
+		t.Errorf("expected rollback to fail without down scripts, got %v, %v", rolledBack, err)
+	}
+}
+
+func TestGuardPostgresRelease(t *testing.T) {
+	dsn, ok := os.LookupEnv("TEST_POSTGRES_DSN")
+	if !ok {
+		t.Skip("TEST_POSTGRES_DSN is not set")
+	}
+
+	db := postgrestest.NewDB(t, dsn)
+
+	// release the lock early, so the guard no longer holds it
+	err := flit.GuardPostgres(t.Context(), mustConn(t, db), func(ctx context.Context, conn *sql.Conn) error {
+		_, err := conn.ExecContext(ctx, "SELECT pg_advisory_unlock_all()")
+		return err
+	})
+
+	if err == nil || !strings.Contains(err.Error(), "not held") {
+		t.Errorf("expected a release error, got %v", err)
+	}
+}
+
+func TestPostgresSchema(t *testing.T) {
+	dsn, ok := os.LookupEnv("TEST_POSTGRES_DSN")
+	if !ok {
+		t.Skip("TEST_POSTGRES_DSN is not set")
+	}
+
+	db := postgrestest.NewDB(t, dsn)
+	if _, err := db.Exec("CREATE SCHEMA migrations"); err != nil {
+		t.Fatal(err)
+	}
+
+	m := flit.New(db, os.DirFS("testdata/example"), flit.WithGuard(flit.GuardPostgres), flit.WithTable("migrations.flits"))
+	if _, err := m.Migrate(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM migrations.flits").Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+
+	if count != 2 {
+		t.Errorf("expected 2 rows in migrations.flits, got %d", count)
+	}
+}
+
+func TestPostgresQuotedTable(t *testing.T) {
+	dsn, ok := os.LookupEnv("TEST_POSTGRES_DSN")
+	if !ok {
+		t.Skip("TEST_POSTGRES_DSN is not set")
+	}
+
+	db := postgrestest.NewDB(t, dsn)
+	if _, err := db.Exec(`CREATE SCHEMA "Audit"`); err != nil {
+		t.Fatal(err)
+	}
+
+	m := flit.New(db, os.DirFS("testdata/example"), flit.WithGuard(flit.GuardPostgres), flit.WithTable("Audit.Flits"))
+	if _, err := m.Migrate(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+
+	// the name keeps its case
+	var count int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM "Audit"."Flits"`).Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+
+	if count != 2 {
+		t.Errorf("expected 2 rows in Audit.Flits, got %d", count)
+	}
+}
+
 func TestOrder(t *testing.T) {
 	db := sqlitetest.NewDB(t)
 	m := flit.New(db, os.DirFS("testdata/lexical-order"))
@@ -70,61 +450,2804 @@ func TestOrder(t *testing.T) {
 	}
 }
 
-func TestMultipleRuns(t *testing.T) {
+func TestWithSort(t *testing.T) {
 	db := sqlitetest.NewDB(t)
-	m := flit.New(db, os.DirFS("testdata/multiple-runs/first"))
+	reverse := func(a, b string) int {
+		return strings.Compare(b, a)
+	}
+
+	m := flit.New(db, os.DirFS("testdata/numeric-order"), flit.WithSort(reverse))
 	applied, err := m.Migrate(t.Context())
 	if err != nil {
 		t.Fatal(err)
 	}
 
 	expect := []string{
-		"001-first.sql",
+		"01-first.sql",
+		"002-second.sql",
 	}
 
 	if diff := cmp.Diff(expect, applied); diff != "" {
-		t.Errorf("first run: applied migrations differ (-want +got):\n%s", diff)
+		t.Errorf("applied migrations differ (-want +got):\n%s", diff)
 	}
+}
 
-	// second is a superset of first
-	m = flit.New(db, os.DirFS("testdata/multiple-runs/second"))
-	applied, err = m.Migrate(t.Context())
+func TestWithNumericOrderingRecursive(t *testing.T) {
+	db := sqlitetest.NewDB(t)
+	fsys := fstest.MapFS{
+		"2024/002-a.sql": {Data: []byte("CREATE TABLE a (id INTEGER);")},
+		"2025/001-b.sql": {Data: []byte("CREATE TABLE b (id INTEGER);")},
+		"2025/10-d.sql":  {Data: []byte("CREATE TABLE d (id INTEGER);")},
+		"2025/9-c.sql":   {Data: []byte("CREATE TABLE c (id INTEGER);")},
+	}
+
+	applied, err := flit.New(db, fsys, flit.WithRecursive(), flit.WithNumericOrdering()).Migrate(t.Context())
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	expect = []string{
-		"002-second.sql",
+	expect := []string{
+		"2024/002-a.sql",
+		"2025/001-b.sql",
+		"2025/9-c.sql",
+		"2025/10-d.sql",
 	}
 
 	if diff := cmp.Diff(expect, applied); diff != "" {
-		t.Errorf("second run: applied migrations differ (-want +got):\n%s", diff)
+		t.Errorf("applied migrations differ (-want +got):\n%s", diff)
 	}
+}
 
-	applied, err = m.Migrate(t.Context())
+func TestWithCaseInsensitiveOrder(t *testing.T) {
+	db := sqlitetest.NewDB(t)
+	fsys := fstest.MapFS{
+		"B-second.sql": {Data: []byte("CREATE TABLE second (id INTEGER);")},
+		"a-first.sql":  {Data: []byte("CREATE TABLE first (id INTEGER);")},
+		"b-third.sql":  {Data: []byte("CREATE TABLE third (id INTEGER);")},
+	}
+
+	applied, err := flit.New(db, fsys, flit.WithCaseInsensitiveOrder()).Migrate(t.Context())
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	if len(applied) != 0 {
-		t.Errorf("third run: expected no migrations, got %v", applied)
+	expect := []string{
+		"a-first.sql",
+		"B-second.sql",
+		"b-third.sql",
+	}
+
+	if diff := cmp.Diff(expect, applied); diff != "" {
+		t.Errorf("applied migrations differ (-want +got):\n%s", diff)
 	}
 }
 
-func TestWithGlob(t *testing.T) {
+func TestWithAdditionalFS(t *testing.T) {
 	db := sqlitetest.NewDB(t)
-	m := flit.New(db, os.DirFS("testdata"), flit.WithGlob("example/*.sql"))
-	applied, err := m.Migrate(t.Context())
+	core := fstest.MapFS{
+		"001-users.sql": {Data: []byte("CREATE TABLE users (id INTEGER);")},
+		"003-roles.sql": {Data: []byte("CREATE TABLE roles (id INTEGER);")},
+	}
+
+	app := fstest.MapFS{
+		"002-posts.sql": {Data: []byte("CREATE TABLE posts (id INTEGER);")},
+		"003-roles.sql": {Data: []byte("CREATE TABLE roles (id INTEGER);")},
+	}
+
+	applied, err := flit.New(db, core, flit.WithAdditionalFS(app)).Migrate(t.Context())
 	if err != nil {
 		t.Fatal(err)
 	}
 
 	expect := []string{
-		"example/001-first.sql",
-		"example/002-second.sql",
+		"001-users.sql",
+		"002-posts.sql",
+		"003-roles.sql",
 	}
 
 	if diff := cmp.Diff(expect, applied); diff != "" {
 		t.Errorf("applied migrations differ (-want +got):\n%s", diff)
 	}
+
+	// the same name with different content is a conflict
+	conflict := fstest.MapFS{
+		"003-roles.sql": {Data: []byte("CREATE TABLE groups (id INTEGER);")},
+	}
+
+	m := flit.New(sqlitetest.NewDB(t), core, flit.WithAdditionalFS(app), flit.WithAdditionalFS(conflict))
+
+	// the copies aren't read until the migration's content is needed
+	pending, err := m.Pending(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := cmp.Diff(expect, pending); diff != "" {
+		t.Errorf("pending migrations differ (-want +got):\n%s", diff)
+	}
+
+	if _, err := m.Migrate(t.Context()); err == nil || !strings.Contains(err.Error(), "migration 003-roles.sql differs between file systems") {
+		t.Errorf("expected a conflict error, got %v", err)
+	}
+}
+
+func TestSumFor(t *testing.T) {
+	db := sqlitetest.NewDB(t)
+	m := flit.New(db, os.DirFS("testdata/example"))
+	if _, err := m.Migrate(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+
+	sum := m.SumFor("subdir/001-first.sql")
+	var name string
+	if err := db.QueryRow("SELECT name FROM flits WHERE sum = ?", sum).Scan(&name); err != nil {
+		t.Fatal(err)
+	}
+
+	if name != "001-first.sql" {
+		t.Errorf("expected the sum to identify 001-first.sql, got %s", name)
+	}
+
+	if namespaced := flit.New(db, nil, flit.WithNamespace("app")).SumFor("001-first.sql"); namespaced == sum {
+		t.Error("expected the namespace to change the sum")
+	}
+}
+
+func TestWithNumericOrdering(t *testing.T) {
+	db := sqlitetest.NewDB(t)
+	fsys := fstest.MapFS{
+		"002-first.sql": {Data: []byte("CREATE TABLE first (id INTEGER);")},
+		"01-second.sql": {Data: []byte("CREATE TABLE second (id INTEGER);")},
+	}
+
+	applied, err := flit.New(db, fsys, flit.WithNumericOrdering()).Migrate(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the reverse of TestOrder
+	expect := []string{
+		"01-second.sql",
+		"002-first.sql",
+	}
+
+	if diff := cmp.Diff(expect, applied); diff != "" {
+		t.Errorf("applied migrations differ (-want +got):\n%s", diff)
+	}
+}
+
+func TestNaturalSort(t *testing.T) {
+	tests := []struct {
+		a, b   string
+		expect int
+	}{
+		{"01-second.sql", "002-first.sql", -1},
+		{"9-ninth.sql", "10-tenth.sql", -1},
+		{"002-b.sql", "2-a.sql", -1},
+		{"001-a.sql", "001-b.sql", -1},
+		{"README.sql", "001-first.sql", 1},
+		{"2024/002-b.sql", "2025/001-a.sql", -1},
+		{"2025/9-b.sql", "2025/10-a.sql", -1},
+		{"001-a.sql", "001-a.sql", 0},
+	}
+
+	for _, test := range tests {
+		if got := flit.NaturalSort(test.a, test.b); got != test.expect {
+			t.Errorf("NaturalSort(%q, %q) = %d, expected %d", test.a, test.b, got, test.expect)
+		}
+	}
+}
+
+func TestMultipleRuns(t *testing.T) {
+	db := sqlitetest.NewDB(t)
+	m := flit.New(db, os.DirFS("testdata/multiple-runs/first"))
+	applied, err := m.Migrate(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect := []string{
+		"001-first.sql",
+	}
+
+	if diff := cmp.Diff(expect, applied); diff != "" {
+		t.Errorf("first run: applied migrations differ (-want +got):\n%s", diff)
+	}
+
+	// second is a superset of first
+	m = flit.New(db, os.DirFS("testdata/multiple-runs/second"))
+	applied, err = m.Migrate(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect = []string{
+		"002-second.sql",
+	}
+
+	if diff := cmp.Diff(expect, applied); diff != "" {
+		t.Errorf("second run: applied migrations differ (-want +got):\n%s", diff)
+	}
+
+	applied, err = m.Migrate(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(applied) != 0 {
+		t.Errorf("third run: expected no migrations, got %v", applied)
+	}
+}
+
+func TestWithGlob(t *testing.T) {
+	db := sqlitetest.NewDB(t)
+	m := flit.New(db, os.DirFS("testdata"), flit.WithGlob("example/*.sql"))
+	applied, err := m.Migrate(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect := []string{
+		"example/001-first.sql",
+		"example/002-second.sql",
+	}
+
+	if diff := cmp.Diff(expect, applied); diff != "" {
+		t.Errorf("applied migrations differ (-want +got):\n%s", diff)
+	}
+}
+
+func TestRollback(t *testing.T) {
+	db := sqlitetest.NewDB(t)
+	m := flit.New(db, os.DirFS("testdata/rollback"))
+	if _, err := m.Migrate(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+
+	rolledBack, err := m.Rollback(t.Context(), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := cmp.Diff([]string{"002-second.sql"}, rolledBack); diff != "" {
+		t.Errorf("first rollback: rolled back migrations differ (-want +got):\n%s", diff)
+	}
+
+	rolledBack, err = m.Rollback(t.Context(), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := cmp.Diff([]string{"001-first.sql"}, rolledBack); diff != "" {
+		t.Errorf("second rollback: rolled back migrations differ (-want +got):\n%s", diff)
+	}
+
+	applied, err := m.Migrate(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := cmp.Diff([]string{"001-first.sql", "002-second.sql"}, applied); diff != "" {
+		t.Errorf("applied migrations differ (-want +got):\n%s", diff)
+	}
+}
+
+func TestRollbackAppliedAt(t *testing.T) {
+	db := sqlitetest.NewDB(t)
+	fsys := fstest.MapFS{
+		"001-first.sql":       {Data: []byte("CREATE TABLE data (id INTEGER);")},
+		"001-first.down.sql":  {Data: []byte("DROP TABLE data;")},
+		"002-second.sql":      {Data: []byte("CREATE TABLE more (id INTEGER);")},
+		"002-second.down.sql": {Data: []byte("DROP TABLE more;")},
+		"003-third.sql":       {Data: []byte("CREATE TABLE other (id INTEGER);")},
+		"003-third.down.sql":  {Data: []byte("DROP TABLE other;")},
+	}
+
+	m := flit.New(db, fsys)
+	if _, err := m.Migrate(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+
+	// 001-first.sql was applied last, such as by a branch merged after the others,
+	// and 002-second.sql and 003-third.sql were applied at the same time
+	for name, appliedAt := range map[string]string{
+		"001-first.sql":  "2030-01-02 00:00:00",
+		"002-second.sql": "2030-01-01 00:00:00",
+		"003-third.sql":  "2030-01-01 00:00:00",
+	} {
+		if _, err := db.Exec("UPDATE flits SET applied_at = ? WHERE name = ?", appliedAt, name); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rolledBack, err := m.Rollback(t.Context(), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := cmp.Diff([]string{"001-first.sql", "003-third.sql"}, rolledBack); diff != "" {
+		t.Errorf("rolled back migrations differ (-want +got):\n%s", diff)
+	}
+}
+
+func TestRollbackMissingDown(t *testing.T) {
+	db := sqlitetest.NewDB(t)
+	m := flit.New(db, os.DirFS("testdata/rollback-missing-down"))
+	if _, err := m.Migrate(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+
+	rolledBack, err := m.Rollback(t.Context(), 2)
+	if err == nil || !strings.Contains(err.Error(), "002-second.sql") {
+		t.Errorf("expected an error naming 002-second.sql, got %v", err)
+	}
+
+	if len(rolledBack) != 0 {
+		t.Errorf("expected no rolled back migrations, got %v", rolledBack)
+	}
+}
+
+func TestRollbackDirty(t *testing.T) {
+	db := sqlitetest.NewDB(t)
+	fsys := fstest.MapFS{
+		"001-first.sql":       {Data: []byte("CREATE TABLE data (id INTEGER);")},
+		"001-first.down.sql":  {Data: []byte("DROP TABLE data;")},
+		"002-second.sql":      {Data: []byte("CREATE TABLE more (id INTEGER);\nINSERT INTO missing (id) VALUES (1);")},
+		"002-second.down.sql": {Data: []byte("DROP TABLE more;")},
+	}
+
+	m := flit.New(db, fsys)
+	if _, err := m.Migrate(t.Context()); err == nil {
+		t.Fatal("expected the migration to fail")
+	}
+
+	rolledBack, err := m.Rollback(t.Context(), 1)
+	if !errors.Is(err, flit.ErrDirty) || !strings.Contains(err.Error(), "002-second.sql") {
+		t.Errorf("expected ErrDirty naming 002-second.sql, got %v", err)
+	}
+
+	if len(rolledBack) != 0 {
+		t.Errorf("expected no rolled back migrations, got %v", rolledBack)
+	}
+
+	if _, err := db.Exec("SELECT * FROM data"); err != nil {
+		t.Errorf("expected the data table to exist: %v", err)
+	}
+}
+
+func TestSections(t *testing.T) {
+	db := sqlitetest.NewDB(t)
+	fsys := fstest.MapFS{
+		"001-first.sql":  {Data: []byte("-- +flit Up\nCREATE TABLE data (id INTEGER);\n\n-- +flit Down\nDROP TABLE data;\n")},
+		"002-second.sql": {Data: []byte("CREATE TABLE more (id INTEGER);")},
+	}
+
+	m := flit.New(db, fsys, flit.WithChecksumVerification(true))
+	if _, err := m.Migrate(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+
+	// the file without sections has no down script
+	if _, err := m.Rollback(t.Context(), 2); err == nil || !strings.Contains(err.Error(), "rollback 002-second.sql: no down script") {
+		t.Errorf("expected an error naming 002-second.sql, got %v", err)
+	}
+
+	// the checksum covers the down section
+	fsys["001-first.sql"] = &fstest.MapFile{Data: []byte("-- +flit Up\nCREATE TABLE data (id INTEGER);\n\n-- +flit Down\nDROP TABLE IF EXISTS data;\n")}
+	if err := m.Verify(t.Context()); !errors.Is(err, flit.ErrChecksumMismatch) {
+		t.Errorf("expected ErrChecksumMismatch, got %v", err)
+	}
+
+	if err := m.Repair(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+
+	fsys["002-second.sql"] = &fstest.MapFile{Data: []byte("CREATE TABLE more (id INTEGER);\n-- +flit Down\nDROP TABLE more;")}
+	if err := m.Repair(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+
+	rolledBack, err := m.Rollback(t.Context(), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := cmp.Diff([]string{"002-second.sql", "001-first.sql"}, rolledBack); diff != "" {
+		t.Errorf("rolled back migrations differ (-want +got):\n%s", diff)
+	}
+
+	if _, err := db.Exec("SELECT * FROM data"); err == nil {
+		t.Error("expected the data table to be dropped")
+	}
+}
+
+func TestSectionsBlankDown(t *testing.T) {
+	db := sqlitetest.NewDB(t)
+	fsys := fstest.MapFS{
+		"001-first.sql":      {Data: []byte("-- +flit Up\nCREATE TABLE data (id INTEGER);\n\n-- +flit Down\n\n")},
+		"001-first.down.sql": {Data: []byte("DROP TABLE data;")},
+		"002-second.sql":     {Data: []byte("-- +flit Up\nCREATE TABLE more (id INTEGER);\n\n-- +flit Down\n")},
+	}
+
+	m := flit.New(db, fsys)
+	if _, err := m.Migrate(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+
+	// a blank down section isn't a down script
+	if _, err := m.Rollback(t.Context(), 1); err == nil || !strings.Contains(err.Error(), "rollback 002-second.sql: no down script") {
+		t.Errorf("expected an error naming 002-second.sql, got %v", err)
+	}
+
+	delete(fsys, "002-second.sql")
+	rolledBack, err := m.Rollback(t.Context(), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := cmp.Diff([]string{"001-first.sql"}, rolledBack); diff != "" {
+		t.Errorf("rolled back migrations differ (-want +got):\n%s", diff)
+	}
+}
+
+func TestRedo(t *testing.T) {
+	db := sqlitetest.NewDB(t)
+	fsys := fstest.MapFS{
+		"001-first.sql":       {Data: []byte("CREATE TABLE data (id INTEGER);")},
+		"001-first.down.sql":  {Data: []byte("DROP TABLE data;")},
+		"002-second.sql":      {Data: []byte("CREATE TABLE more (id INTEGER);")},
+		"002-second.down.sql": {Data: []byte("DROP TABLE more;")},
+	}
+
+	m := flit.New(db, fsys)
+	if _, err := m.Migrate(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+
+	fsys["002-second.sql"] = &fstest.MapFile{Data: []byte("CREATE TABLE more (id INTEGER, name TEXT);")}
+	if err := m.Redo(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := db.Exec("INSERT INTO more (id, name) VALUES (1, 'one')"); err != nil {
+		t.Errorf("expected the edited migration to be applied: %v", err)
+	}
+
+	// the new checksum was recorded
+	if err := m.Verify(t.Context()); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRedoMissingDown(t *testing.T) {
+	db := sqlitetest.NewDB(t)
+	m := flit.New(db, os.DirFS("testdata/rollback-missing-down"))
+	if err := m.Redo(t.Context()); err == nil || !strings.Contains(err.Error(), "no applied migrations") {
+		t.Errorf("expected an error for no applied migrations, got %v", err)
+	}
+
+	if _, err := m.Migrate(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.Redo(t.Context()); err == nil || !strings.Contains(err.Error(), "redo 002-second.sql: no down script") {
+		t.Errorf("expected an error naming 002-second.sql, got %v", err)
+	}
+}
+
+func TestAppliedAt(t *testing.T) {
+	db := sqlitetest.NewDB(t)
+
+	// a table created by an older version of flit
+	if _, err := db.Exec("CREATE TABLE flits (sum CHAR(64) PRIMARY KEY)"); err != nil {
+		t.Fatal(err)
+	}
+
+	m := flit.New(db, os.DirFS("testdata/example"))
+	if _, err := m.Migrate(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+
+	var missing int
+	if err := db.QueryRow("SELECT COUNT(*) FROM flits WHERE applied_at IS NULL").Scan(&missing); err != nil {
+		t.Fatal(err)
+	}
+
+	if missing != 0 {
+		t.Errorf("expected every migration to have applied_at, %d are missing it", missing)
+	}
+}
+
+func TestAppliedAtLookup(t *testing.T) {
+	db := sqlitetest.NewDB(t)
+
+	// a table created by an older version of flit, with 002-second.sql recorded without a time
+	legacy := sha256.Sum256([]byte("002-second.sql"))
+	if _, err := db.Exec("CREATE TABLE flits (sum CHAR(64) PRIMARY KEY)"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := db.Exec("INSERT INTO flits (sum) VALUES (?)", hex.EncodeToString(legacy[:])); err != nil {
+		t.Fatal(err)
+	}
+
+	m := flit.New(db, os.DirFS("testdata/example"))
+	if _, ok, err := m.AppliedAt(t.Context(), "001-first.sql"); err != nil || ok {
+		t.Errorf("expected 001-first.sql not to be applied, got %v, %v", ok, err)
+	}
+
+	if _, err := m.Migrate(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+
+	appliedAt, ok, err := m.AppliedAt(t.Context(), "001-first.sql")
+	if err != nil || !ok {
+		t.Fatalf("expected 001-first.sql to be applied, got %v, %v", ok, err)
+	}
+
+	if d := time.Since(appliedAt); d < -time.Minute || d > time.Minute {
+		t.Errorf("expected 001-first.sql to have been applied just now, got %v", appliedAt)
+	}
+
+	if _, _, err := m.AppliedAt(t.Context(), "002-second.sql"); err == nil || !strings.Contains(err.Error(), "wasn't recorded") {
+		t.Errorf("expected an error for 002-second.sql, got %v", err)
+	}
+}
+
+func TestChecksumVerificationLegacy(t *testing.T) {
+	db := sqlitetest.NewDB(t)
+
+	// a table created by an older version of flit, which didn't record checksums
+	if _, err := db.Exec("CREATE TABLE flits (sum CHAR(64) PRIMARY KEY)"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := db.Exec("CREATE TABLE data (id NUMERIC PRIMARY KEY)"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := db.Exec("INSERT INTO flits (sum) VALUES (?)", fmt.Sprintf("%x", sha256.Sum256([]byte("001-first.sql")))); err != nil {
+		t.Fatal(err)
+	}
+
+	m := flit.New(db, os.DirFS("testdata/multiple-runs/second"), flit.WithChecksumVerification(true))
+	applied, err := m.Migrate(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := cmp.Diff([]string{"002-second.sql"}, applied); diff != "" {
+		t.Errorf("applied migrations differ (-want +got):\n%s", diff)
+	}
+
+	var checksum sql.NullString
+	if err := db.QueryRow("SELECT checksum FROM flits WHERE name = '002-second.sql'").Scan(&checksum); err != nil {
+		t.Fatal(err)
+	}
+
+	if !checksum.Valid {
+		t.Error("expected the checksum of 002-second.sql to be recorded")
+	}
+}
+
+func TestCompletedQueryError(t *testing.T) {
+	db := sqlitetest.NewDB(t)
+
+	// a flits table without a sum column makes loading completed migrations fail
+	if _, err := db.Exec("CREATE TABLE flits (applied_at TIMESTAMP)"); err != nil {
+		t.Fatal(err)
+	}
+
+	m := flit.New(db, os.DirFS("testdata/example"))
+	applied, err := m.Migrate(t.Context())
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+
+	if len(applied) != 0 {
+		t.Errorf("expected no migrations, got %v", applied)
+	}
+}
+
+func TestChecksumVerification(t *testing.T) {
+	db := sqlitetest.NewDB(t)
+	fsys := fstest.MapFS{
+		"001-first.sql": {Data: []byte("CREATE TABLE data (id NUMERIC PRIMARY KEY);")},
+	}
+
+	m := flit.New(db, fsys, flit.WithChecksumVerification(true))
+	if _, err := m.Migrate(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+
+	// rewrite history
+	fsys["001-first.sql"] = &fstest.MapFile{Data: []byte("CREATE TABLE data (id INTEGER PRIMARY KEY);")}
+
+	if _, err := m.Migrate(t.Context()); !errors.Is(err, flit.ErrChecksumMismatch) {
+		t.Errorf("expected ErrChecksumMismatch, got %v", err)
+	}
+
+	m = flit.New(db, fsys)
+	if _, err := m.Migrate(t.Context()); err != nil {
+		t.Errorf("expected no error without verification, got %v", err)
+	}
+}
+
+func TestWithTable(t *testing.T) {
+	db := sqlitetest.NewDB(t)
+	first := flit.New(db, fstest.MapFS{
+		"001-first.sql": {Data: []byte("CREATE TABLE first (id NUMERIC PRIMARY KEY);")},
+	}, flit.WithTable("first_flits"))
+
+	second := flit.New(db, fstest.MapFS{
+		"001-first.sql":  {Data: []byte("CREATE TABLE second (id NUMERIC PRIMARY KEY);")},
+		"002-second.sql": {Data: []byte("ALTER TABLE second ADD COLUMN name VARCHAR(255);")},
+	}, flit.WithTable("second_flits"))
+
+	applied, err := first.Migrate(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := cmp.Diff([]string{"001-first.sql"}, applied); diff != "" {
+		t.Errorf("first: applied migrations differ (-want +got):\n%s", diff)
+	}
+
+	applied, err = second.Migrate(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := cmp.Diff([]string{"001-first.sql", "002-second.sql"}, applied); diff != "" {
+		t.Errorf("second: applied migrations differ (-want +got):\n%s", diff)
+	}
+
+	for table, expect := range map[string]int{"first_flits": 1, "second_flits": 2} {
+		var count int
+		if err := db.QueryRow("SELECT COUNT(*) FROM " + table).Scan(&count); err != nil {
+			t.Fatal(err)
+		}
+
+		if count != expect {
+			t.Errorf("expected %d rows in %s, got %d", expect, table, count)
+		}
+	}
+}
+
+func TestWithTableReservedWord(t *testing.T) {
+	db := sqlitetest.NewDB(t)
+	m := flit.New(db, os.DirFS("testdata/example"), flit.WithTable("order"))
+	if _, err := m.Migrate(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+
+	var count int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM "order"`).Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+
+	if count != 2 {
+		t.Errorf("expected 2 rows in order, got %d", count)
+	}
+}
+
+func TestWithTableInvalid(t *testing.T) {
+	db := sqlitetest.NewDB(t)
+	for _, name := range []string{"flits; DROP TABLE data", "a.b.c", "migrations.", ".flits", "migrations.1flits"} {
+		m := flit.New(db, os.DirFS("testdata/example"), flit.WithTable(name))
+		if _, err := m.Migrate(t.Context()); err == nil || !strings.Contains(err.Error(), "invalid table name") {
+			t.Errorf("%s: expected an invalid table name error, got %v", name, err)
+		}
+	}
+}
+
+func TestWithTableSchema(t *testing.T) {
+	db := sqlitetest.NewDB(t)
+
+	// attached databases belong to a connection
+	db.SetMaxOpenConns(1)
+
+	m := flit.New(db, os.DirFS("testdata/example"), flit.WithTable("migrations.flits"))
+	if _, err := m.Migrate(t.Context()); err == nil || !strings.Contains(err.Error(), "migrations.flits") {
+		t.Errorf("expected an error naming the table when the schema is missing, got %v", err)
+	}
+
+	if _, err := db.Exec("ATTACH DATABASE ':memory:' AS migrations"); err != nil {
+		t.Fatal(err)
+	}
+
+	applied, err := m.Migrate(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := cmp.Diff([]string{"001-first.sql", "002-second.sql"}, applied); diff != "" {
+		t.Errorf("applied migrations differ (-want +got):\n%s", diff)
+	}
+
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM migrations.flits").Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+
+	if count != 2 {
+		t.Errorf("expected 2 rows in migrations.flits, got %d", count)
+	}
+}
+
+func TestWithTransactions(t *testing.T) {
+	db := sqlitetest.NewDB(t)
+	m := flit.New(db, fstest.MapFS{
+		"001-first.sql": {Data: []byte("CREATE TABLE data (id NUMERIC PRIMARY KEY); INSERT INTO missing VALUES (1);")},
+	}, flit.WithTransactions())
+
+	if _, err := m.Migrate(t.Context()); err == nil {
+		t.Fatal("expected an error")
+	}
+
+	// the CREATE TABLE statement was rolled back
+	if _, err := db.Exec("SELECT * FROM data"); err == nil {
+		t.Error("expected the data table to not exist")
+	}
+}
+
+func TestMultipleStatements(t *testing.T) {
+	db := sqlitetest.NewDB(t)
+	var stmts []string
+	split := flit.WithStatementSplitter(func(sql string) []string {
+		stmts = append(stmts, sql)
+		return []string{sql}
+	})
+
+	m := flit.New(db, os.DirFS("testdata/multiple-statements"))
+	if _, err := m.Migrate(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, table := range []string{"first", "second", "third"} {
+		if _, err := db.Exec("SELECT * FROM " + table); err != nil {
+			t.Errorf("select from %s: %v", table, err)
+		}
+	}
+
+	var name string
+	if _, err := db.Exec("INSERT INTO second (id) VALUES (1)"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.QueryRow("SELECT name FROM second").Scan(&name); err != nil {
+		t.Fatal(err)
+	}
+
+	if name != "not;\nthe end;" {
+		t.Errorf("expected the default to be preserved, got %q", name)
+	}
+
+	// a custom splitter replaces the default
+	m = flit.New(sqlitetest.NewDB(t), os.DirFS("testdata/example"), split)
+	if _, err := m.Migrate(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(stmts) != 2 {
+		t.Errorf("expected the custom splitter to be called for 2 migrations, got %d", len(stmts))
+	}
+}
+
+func TestDefaultSplitter(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		sql   string
+		stmts []string
+	}{
+		{
+			name:  "block comments",
+			sql:   "/* setup;\n   more; */\nCREATE TABLE data (id INT);\n/* outer /* nested; */\n still a comment; */\nINSERT INTO data VALUES (1);\n/* trailing; */\n",
+			stmts: []string{"/* setup;\n   more; */\nCREATE TABLE data (id INT);", "/* outer /* nested; */\n still a comment; */\nINSERT INTO data VALUES (1);"},
+		},
+		{
+			name: "dollar quotes",
+			sql: "CREATE FUNCTION one() RETURNS INT AS $$\nBEGIN\n  RETURN 1;\nEND;\n$$ LANGUAGE plpgsql;\n" +
+				"CREATE FUNCTION two() RETURNS TEXT AS $body$\nSELECT '$$;\n';\n$body$ LANGUAGE sql;\n" +
+				"SELECT $1;\n",
+			stmts: []string{
+				"CREATE FUNCTION one() RETURNS INT AS $$\nBEGIN\n  RETURN 1;\nEND;\n$$ LANGUAGE plpgsql;",
+				"CREATE FUNCTION two() RETURNS TEXT AS $body$\nSELECT '$$;\n';\n$body$ LANGUAGE sql;",
+				"SELECT $1;",
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			connector := new(recordingConnector)
+			db := sql.OpenDB(connector)
+			defer db.Close()
+
+			m := flit.New(db, fstest.MapFS{"001-first.sql": {Data: []byte(tc.sql)}})
+			if _, err := m.Migrate(t.Context()); err != nil {
+				t.Fatal(err)
+			}
+
+			// Flit's own statements all name its table
+			var stmts []string
+			for _, q := range connector.queries {
+				if !strings.Contains(q, "`flits`") {
+					stmts = append(stmts, q)
+				}
+			}
+
+			if diff := cmp.Diff(tc.stmts, stmts); diff != "" {
+				t.Errorf("statements differ (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestExecError(t *testing.T) {
+	db := sqlitetest.NewDB(t)
+	fsys := fstest.MapFS{
+		"001-first.sql": {Data: []byte("CREATE TABLE data (id INTEGER);\n" +
+			"INSERT INTO data (id) VALUES (1);\n" +
+			"INSERT INTO missing (id, name, description, created_at) VALUES (2, 'two', 'the second row', CURRENT_TIMESTAMP);")},
+	}
+
+	_, err := flit.New(db, fsys).Migrate(t.Context())
+	if !errors.Is(err, flit.ErrExec) {
+		t.Fatalf("expected ErrExec, got %v", err)
+	}
+
+	var execErr *flit.ExecError
+	if !errors.As(err, &execErr) {
+		t.Fatalf("expected an ExecError, got %T", err)
+	}
+
+	if execErr.Statement != 3 {
+		t.Errorf("expected statement 3 to fail, got %d", execErr.Statement)
+	}
+
+	if errors.Unwrap(execErr) != execErr.Err || execErr.Err == nil {
+		t.Errorf("expected Unwrap to return the driver's error, got %v", errors.Unwrap(execErr))
+	}
+
+	want := "apply 001-first.sql: statement 3 (INSERT INTO missing (id, name, description, created_at) VALU...): "
+	if !strings.HasPrefix(err.Error(), want) {
+		t.Errorf("expected the error to start with %q, got %q", want, err)
+	}
+}
+
+func TestStatus(t *testing.T) {
+	db := sqlitetest.NewDB(t)
+	m := flit.New(db, os.DirFS("testdata/multiple-runs/second"))
+	status, err := m.Status(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ignoreTimes := cmpopts.IgnoreFields(flit.Status{}, "AppliedAt")
+	expect := &flit.Status{Pending: []string{"001-first.sql", "002-second.sql"}}
+	if diff := cmp.Diff(expect, status, ignoreTimes); diff != "" {
+		t.Errorf("initial status differs (-want +got):\n%s", diff)
+	}
+
+	if _, err := m.Migrate(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+
+	// first is missing 002-second.sql
+	m = flit.New(db, os.DirFS("testdata/multiple-runs/first"))
+	status, err = m.Status(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect = &flit.Status{
+		Applied: []string{"001-first.sql"},
+		Orphans: []string{fmt.Sprintf("%x", sha256.Sum256([]byte("002-second.sql")))},
+	}
+
+	if diff := cmp.Diff(expect, status, ignoreTimes); diff != "" {
+		t.Errorf("status differs (-want +got):\n%s", diff)
+	}
+
+	if _, ok := status.AppliedAt["001-first.sql"]; !ok {
+		t.Error("expected the time 001-first.sql was applied")
+	}
+}
+
+func TestPlan(t *testing.T) {
+	db := sqlitetest.NewDB(t)
+	m := flit.New(db, os.DirFS("testdata/example"))
+	planned, err := m.Plan(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := cmp.Diff([]string{"001-first.sql", "002-second.sql"}, planned); diff != "" {
+		t.Errorf("planned migrations differ (-want +got):\n%s", diff)
+	}
+
+	// nothing was applied
+	applied, err := m.Migrate(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := cmp.Diff(planned, applied); diff != "" {
+		t.Errorf("applied migrations differ from the plan (-want +got):\n%s", diff)
+	}
+}
+
+func TestPlanJSON(t *testing.T) {
+	db := sqlitetest.NewDB(t)
+	m := flit.New(db, os.DirFS("testdata/example"), flit.WithChecksumVerification(true))
+	var buf strings.Builder
+	if err := m.PlanJSON(t.Context(), &buf); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile("testdata/example/001-first.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	nameSum, checksum := sha256.Sum256([]byte("001-first.sql")), sha256.Sum256(data)
+	want := `{
+  "migrations": [
+    {
+      "name": "001-first.sql",
+      "sum": "` + hex.EncodeToString(nameSum[:]) + `",
+      "checksum": "` + hex.EncodeToString(checksum[:]) + `"
+    },
+`
+	if got := buf.String(); !strings.HasPrefix(got, want) {
+		t.Errorf("expected the plan to start with\n%s\ngot\n%s", want, got)
+	}
+
+	if _, err := m.Migrate(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+
+	buf.Reset()
+	if err := m.PlanJSON(t.Context(), &buf); err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := cmp.Diff("{\n  \"migrations\": []\n}\n", buf.String()); diff != "" {
+		t.Errorf("empty plan differs (-want +got):\n%s", diff)
+	}
+}
+
+func TestListApplied(t *testing.T) {
+	db := sqlitetest.NewDB(t)
+	m := flit.New(db, os.DirFS("testdata/multiple-runs/second"))
+	applied, err := m.ListApplied(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := cmp.Diff([]string{}, applied); diff != "" {
+		t.Errorf("initially applied migrations differ (-want +got):\n%s", diff)
+	}
+
+	if _, err := flit.New(db, os.DirFS("testdata/multiple-runs/first")).Migrate(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := m.Migrate(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+
+	applied, err = m.ListApplied(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := cmp.Diff([]string{"001-first.sql", "002-second.sql"}, applied); diff != "" {
+		t.Errorf("applied migrations differ (-want +got):\n%s", diff)
+	}
+}
+
+func TestListAppliedNames(t *testing.T) {
+	db := sqlitetest.NewDB(t)
+
+	// a table created by an older version of flit
+	if _, err := db.Exec("CREATE TABLE flits (sum CHAR(64) PRIMARY KEY)"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := db.Exec("CREATE TABLE data (id NUMERIC PRIMARY KEY)"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := db.Exec("INSERT INTO flits (sum) VALUES (?)", fmt.Sprintf("%x", sha256.Sum256([]byte("001-first.sql")))); err != nil {
+		t.Fatal(err)
+	}
+
+	applied, err := flit.New(db, os.DirFS("testdata/multiple-runs/second")).Migrate(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := cmp.Diff([]string{"002-second.sql"}, applied); diff != "" {
+		t.Errorf("applied migrations differ (-want +got):\n%s", diff)
+	}
+
+	// 001-first.sql is named by matching its sum, 002-second.sql by its recorded name
+	applied, err = flit.New(db, os.DirFS("testdata/multiple-runs/first")).ListApplied(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := cmp.Diff([]string{"001-first.sql", "002-second.sql"}, applied); diff != "" {
+		t.Errorf("listed migrations differ (-want +got):\n%s", diff)
+	}
+}
+
+func BenchmarkMigrateUpToDate(b *testing.B) {
+	db := sqlitetest.NewDB(b)
+	fsys := make(fstest.MapFS)
+	for i := range 1000 {
+		fsys[fmt.Sprintf("%04d-table.sql", i)] = &fstest.MapFile{
+			Data: fmt.Appendf(nil, "CREATE TABLE t%d (id NUMERIC PRIMARY KEY);", i),
+		}
+	}
+
+	m := flit.New(db, fsys)
+	if _, err := m.Migrate(b.Context()); err != nil {
+		b.Fatal(err)
+	}
+
+	for b.Loop() {
+		if _, err := m.Migrate(b.Context()); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkMigrateFirstRun(b *testing.B) {
+	fsys := make(fstest.MapFS)
+	for i := range 500 {
+		fsys[fmt.Sprintf("%04d-select.sql", i)] = &fstest.MapFile{Data: []byte("SELECT 1;")}
+	}
+
+	for b.Loop() {
+		b.StopTimer()
+		m := flit.New(sqlitetest.NewDB(b), fsys)
+		b.StartTimer()
+
+		if _, err := m.Migrate(b.Context()); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestHooks(t *testing.T) {
+	db := sqlitetest.NewDB(t)
+
+	var calls []string
+	before := flit.WithBeforeEach(func(ctx context.Context, name string) error {
+		calls = append(calls, "before "+name)
+		if name == "002-second.sql" {
+			return errors.New("not yet")
+		}
+
+		return nil
+	})
+
+	after := flit.WithAfterEach(func(ctx context.Context, name string, err error) error {
+		calls = append(calls, fmt.Sprintf("after %s: %v", name, err))
+		return err
+	})
+
+	m := flit.New(db, os.DirFS("testdata/example"), before, after)
+	applied, err := m.Migrate(t.Context())
+	if err == nil || !strings.Contains(err.Error(), "002-second.sql") {
+		t.Errorf("expected an error naming 002-second.sql, got %v", err)
+	}
+
+	if diff := cmp.Diff([]string{"001-first.sql"}, applied); diff != "" {
+		t.Errorf("applied migrations differ (-want +got):\n%s", diff)
+	}
+
+	expect := []string{
+		"before 001-first.sql",
+		"after 001-first.sql: <nil>",
+		"before 002-second.sql",
+	}
+
+	if diff := cmp.Diff(expect, calls); diff != "" {
+		t.Errorf("hook calls differ (-want +got):\n%s", diff)
+	}
+}
+
+func TestWithLogger(t *testing.T) {
+	db := sqlitetest.NewDB(t)
+
+	var buf strings.Builder
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	m := flit.New(db, os.DirFS("testdata/example"), flit.WithLogger(logger))
+	if _, err := m.Migrate(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, msg := range []string{
+		"flit: lock acquired",
+		"flit: table ensured",
+		"flit: applied migration",
+		"name=002-second.sql",
+		"flit: lock released",
+		"applied=2",
+	} {
+		if !strings.Contains(buf.String(), msg) {
+			t.Errorf("expected log to contain %q:\n%s", msg, buf.String())
+		}
+	}
+}
+
+func TestMigrateResult(t *testing.T) {
+	db := sqlitetest.NewDB(t)
+	m := flit.New(db, os.DirFS("testdata/example"))
+	result, err := m.MigrateResult(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for _, r := range result.Applied {
+		names = append(names, r.Name)
+		if r.Duration <= 0 {
+			t.Errorf("expected %s to have a positive duration, got %v", r.Name, r.Duration)
+		}
+
+		if want := fmt.Sprintf("%x", sha256.Sum256([]byte(r.Name))); r.Sum != want {
+			t.Errorf("expected %s to have sum %s, got %s", r.Name, want, r.Sum)
+		}
+	}
+
+	if diff := cmp.Diff([]string{"001-first.sql", "002-second.sql"}, names); diff != "" {
+		t.Errorf("applied migrations differ (-want +got):\n%s", diff)
+	}
+
+	if result.UpToDate != 0 {
+		t.Errorf("expected no migrations to be up to date, got %d", result.UpToDate)
+	}
+
+	// a run that applies nothing reports the migrations that are up to date
+	result, err = m.MigrateResult(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(result.Applied) != 0 || result.UpToDate != 2 {
+		t.Errorf("expected 0 applied and 2 up to date, got %d and %d", len(result.Applied), result.UpToDate)
+	}
+}
+
+func TestWithRecursive(t *testing.T) {
+	db := sqlitetest.NewDB(t)
+	m := flit.New(db, os.DirFS("testdata/recursive"), flit.WithRecursive())
+	applied, err := m.Migrate(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect := []string{
+		"2024/001-first.sql",
+		"2024/002-notes.sql",
+		"2025/001-second.sql",
+	}
+
+	if diff := cmp.Diff(expect, applied); diff != "" {
+		t.Errorf("applied migrations differ (-want +got):\n%s", diff)
+	}
+
+	applied, err = m.Migrate(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(applied) != 0 {
+		t.Errorf("second run: expected no migrations, got %v", applied)
+	}
+}
+
+func TestWithGlobs(t *testing.T) {
+	db := sqlitetest.NewDB(t)
+	m := flit.New(db, os.DirFS("testdata"), flit.WithGlobs("example/002-*.sql", "example/*.sql", "recursive/*/*-second.sql"))
+	planned, err := m.Plan(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect := []string{
+		"example/001-first.sql",
+		"example/002-second.sql",
+		"recursive/2025/001-second.sql",
+	}
+
+	if diff := cmp.Diff(expect, planned); diff != "" {
+		t.Errorf("planned migrations differ (-want +got):\n%s", diff)
+	}
+
+	// migrations are identified by their file names, which must be unique
+	m = flit.New(db, os.DirFS("testdata"), flit.WithGlobs("multiple-runs/*/001-*.sql"))
+	if _, err := m.Plan(t.Context()); err == nil || !strings.Contains(err.Error(), "same file name") {
+		t.Errorf("expected an error for duplicate file names, got %v", err)
+	}
+}
+
+func TestSumIgnoresDirectory(t *testing.T) {
+	db := sqlitetest.NewDB(t)
+	if _, err := flit.New(db, os.DirFS("testdata/example")).Migrate(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+
+	// the same migrations loaded from the parent directory
+	m := flit.New(db, os.DirFS("testdata"), flit.WithGlob("example/*.sql"))
+	applied, err := m.Migrate(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(applied) != 0 {
+		t.Errorf("expected no migrations to be applied again, got %v", applied)
+	}
+}
+
+func TestLegacySums(t *testing.T) {
+	db := sqlitetest.NewDB(t)
+
+	// rows recorded by an older version of flit, which summed the full path
+	m := flit.New(db, os.DirFS("testdata"), flit.WithGlob("example/*.sql"))
+	if _, err := m.Status(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := db.Exec("CREATE TABLE data (id NUMERIC PRIMARY KEY)"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := db.Exec("INSERT INTO flits (sum, name) VALUES (?, ?)", fmt.Sprintf("%x", sha256.Sum256([]byte("example/001-first.sql"))), "example/001-first.sql"); err != nil {
+		t.Fatal(err)
+	}
+
+	applied, err := m.Migrate(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := cmp.Diff([]string{"example/002-second.sql"}, applied); diff != "" {
+		t.Errorf("applied migrations differ (-want +got):\n%s", diff)
+	}
+
+	var sum string
+	if err := db.QueryRow("SELECT sum FROM flits WHERE name = 'example/001-first.sql'").Scan(&sum); err != nil {
+		t.Fatal(err)
+	}
+
+	if expect := fmt.Sprintf("%x", sha256.Sum256([]byte("001-first.sql"))); sum != expect {
+		t.Errorf("expected the sum to be upgraded to %s, got %s", expect, sum)
+	}
+}
+
+func TestWithExclude(t *testing.T) {
+	db := sqlitetest.NewDB(t)
+	m := flit.New(db, os.DirFS("testdata/exclude"), flit.WithExclude("*_helper.sql", "fixture.sql"))
+	applied, err := m.Migrate(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := cmp.Diff([]string{"001-first.sql", "002-second.sql"}, applied); diff != "" {
+		t.Errorf("applied migrations differ (-want +got):\n%s", diff)
+	}
+
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM flits").Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+
+	if count != 2 {
+		t.Errorf("expected 2 recorded migrations, got %d", count)
+	}
+}
+
+func TestWithStrictOrphans(t *testing.T) {
+	db := sqlitetest.NewDB(t)
+	if _, err := flit.New(db, os.DirFS("testdata/multiple-runs/second")).Migrate(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+
+	// first is missing 002-second.sql
+	m := flit.New(db, os.DirFS("testdata/multiple-runs/first"), flit.WithStrictOrphans())
+	_, err := m.Migrate(t.Context())
+	if !errors.Is(err, flit.ErrOrphanedMigration) {
+		t.Fatalf("expected ErrOrphanedMigration, got %v", err)
+	}
+
+	if sum := fmt.Sprintf("%x", sha256.Sum256([]byte("002-second.sql"))); !strings.Contains(err.Error(), sum) {
+		t.Errorf("expected the error to contain %s, got %v", sum, err)
+	}
+
+	if _, err := flit.New(db, os.DirFS("testdata/multiple-runs/first")).Migrate(t.Context()); err != nil {
+		t.Errorf("expected no error without strict orphans, got %v", err)
+	}
+}
+
+func TestWithStrictOrdering(t *testing.T) {
+	db := sqlitetest.NewDB(t)
+	m := flit.New(db, os.DirFS("testdata/out-of-order"), flit.WithExclude("001-second.sql"))
+	if _, err := m.Migrate(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+
+	// 001-second.sql was added after 002-third.sql was applied
+	m = flit.New(db, os.DirFS("testdata/out-of-order"), flit.WithStrictOrdering())
+	_, err := m.Migrate(t.Context())
+	if !errors.Is(err, flit.ErrOutOfOrder) {
+		t.Fatalf("expected ErrOutOfOrder, got %v", err)
+	}
+
+	for _, name := range []string{"001-second.sql", "002-third.sql"} {
+		if !strings.Contains(err.Error(), name) {
+			t.Errorf("expected the error to name %s, got %v", name, err)
+		}
+	}
+
+	applied, err := flit.New(db, os.DirFS("testdata/out-of-order")).Migrate(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := cmp.Diff([]string{"001-second.sql"}, applied); diff != "" {
+		t.Errorf("applied migrations differ without strict ordering (-want +got):\n%s", diff)
+	}
+}
+
+func TestPending(t *testing.T) {
+	db := sqlitetest.NewDB(t)
+	if _, err := flit.New(db, os.DirFS("testdata/multiple-runs/first")).Migrate(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+
+	m := flit.New(db, os.DirFS("testdata/multiple-runs/second"))
+	pending, err := m.Pending(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := cmp.Diff([]string{"002-second.sql"}, pending); diff != "" {
+		t.Errorf("pending migrations differ (-want +got):\n%s", diff)
+	}
+}
+
+func TestBaseline(t *testing.T) {
+	db := sqlitetest.NewDB(t)
+
+	// the schema was created without flit
+	if _, err := db.Exec("CREATE TABLE data (id NUMERIC PRIMARY KEY, name VARCHAR(255) NOT NULL)"); err != nil {
+		t.Fatal(err)
+	}
+
+	m := flit.New(db, os.DirFS("testdata/baseline"))
+	if err := m.Baseline(t.Context(), "missing.sql"); err == nil {
+		t.Error("expected an error for an unknown migration")
+	}
+
+	if err := m.Baseline(t.Context(), "002-second.sql"); err != nil {
+		t.Fatal(err)
+	}
+
+	applied, err := m.Migrate(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := cmp.Diff([]string{"003-third.sql"}, applied); diff != "" {
+		t.Errorf("applied migrations differ (-want +got):\n%s", diff)
+	}
+}
+
+func TestMarkApplied(t *testing.T) {
+	db := sqlitetest.NewDB(t)
+	m := flit.New(db, os.DirFS("testdata/baseline"))
+	if err := m.MarkApplied(t.Context(), "002-second.sql", "missing.sql"); err == nil || !strings.Contains(err.Error(), "mark missing.sql: unknown migration") {
+		t.Errorf("expected an error for an unknown migration, got %v", err)
+	}
+
+	if err := m.MarkApplied(t.Context(), "002-second.sql"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.MarkApplied(t.Context(), "002-second.sql"); err == nil || !strings.Contains(err.Error(), "mark 002-second.sql: already applied") {
+		t.Errorf("expected an error for a recorded migration, got %v", err)
+	}
+
+	pending, err := m.Pending(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := cmp.Diff([]string{"001-first.sql", "003-third.sql"}, pending); diff != "" {
+		t.Errorf("pending migrations differ (-want +got):\n%s", diff)
+	}
+}
+
+func TestUnmark(t *testing.T) {
+	db := sqlitetest.NewDB(t)
+	m := flit.New(db, os.DirFS("testdata/baseline"))
+	if err := m.MarkApplied(t.Context(), "001-first.sql", "002-second.sql"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.Unmark(t.Context(), "002-second.sql"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.Unmark(t.Context(), "002-second.sql"); err == nil || !strings.Contains(err.Error(), "unmark 002-second.sql: not recorded") {
+		t.Errorf("expected an error for an unrecorded migration, got %v", err)
+	}
+
+	pending, err := m.Pending(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := cmp.Diff([]string{"002-second.sql", "003-third.sql"}, pending); diff != "" {
+		t.Errorf("pending migrations differ (-want +got):\n%s", diff)
+	}
+}
+
+func TestMigrateTo(t *testing.T) {
+	db := sqlitetest.NewDB(t)
+	m := flit.New(db, os.DirFS("testdata/baseline"))
+	if _, err := m.MigrateTo(t.Context(), "missing.sql"); err == nil {
+		t.Error("expected an error for an unknown migration")
+	}
+
+	applied, err := m.MigrateTo(t.Context(), "002-second.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := cmp.Diff([]string{"001-first.sql", "002-second.sql"}, applied); diff != "" {
+		t.Errorf("applied migrations differ (-want +got):\n%s", diff)
+	}
+
+	applied, err = m.MigrateTo(t.Context(), "001-first.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(applied) != 0 {
+		t.Errorf("expected no migrations for an applied target, got %v", applied)
+	}
+
+	applied, err = m.Migrate(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := cmp.Diff([]string{"003-third.sql"}, applied); diff != "" {
+		t.Errorf("remaining migrations differ (-want +got):\n%s", diff)
+	}
+}
+
+func TestMigrateToAppliedTarget(t *testing.T) {
+	db := sqlitetest.NewDB(t)
+	fsys := fstest.MapFS{
+		"002-b.sql": {Data: []byte("CREATE TABLE b (id INTEGER);")},
+	}
+
+	if _, err := flit.New(db, fsys).Migrate(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+
+	// a migration ordered before the applied target is added later
+	fsys["001-a.sql"] = &fstest.MapFile{Data: []byte("CREATE TABLE a (id INTEGER);")}
+	applied, err := flit.New(db, fsys).MigrateTo(t.Context(), "002-b.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(applied) != 0 {
+		t.Errorf("expected no migrations to be applied, got %v", applied)
+	}
+}
+
+func TestRegister(t *testing.T) {
+	db := sqlitetest.NewDB(t)
+	m := flit.New(db, os.DirFS("testdata/example"))
+
+	var calls int
+	m.Register("003-backfill", func(ctx context.Context, conn *sql.Conn) error {
+		calls++
+		_, err := conn.ExecContext(ctx, "INSERT INTO data (id, name) VALUES (1, 'one')")
+		return err
+	})
+
+	applied, err := m.Migrate(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect := []string{
+		"001-first.sql",
+		"002-second.sql",
+		"003-backfill",
+	}
+
+	if diff := cmp.Diff(expect, applied); diff != "" {
+		t.Errorf("applied migrations differ (-want +got):\n%s", diff)
+	}
+
+	applied, err = m.Migrate(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(applied) != 0 || calls != 1 {
+		t.Errorf("second run: expected no migrations and 1 call, got %v and %d calls", applied, calls)
+	}
+}
+
+// mapSource is a flit.Source backed by a map of file names to contents.
+type mapSource map[string]string
+
+func (s mapSource) Names() ([]string, error) {
+	var names []string
+	for name := range s {
+		names = append(names, name)
+	}
+
+	return names, nil
+}
+
+func (s mapSource) Open(name string) (io.ReadCloser, error) {
+	data, ok := s[name]
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+
+	return io.NopCloser(strings.NewReader(data)), nil
+}
+
+func TestNewWithSource(t *testing.T) {
+	db := sqlitetest.NewDB(t)
+	m := flit.NewWithSource(db, mapSource{
+		"002-second.sql":      "INSERT INTO data (id) VALUES (1);",
+		"001-first.sql":       "CREATE TABLE data (id INTEGER);",
+		"001-first.down.sql":  "DROP TABLE data;",
+		"003-skipped.sql.bak": "not sql",
+	}, flit.WithExclude("*.bak"))
+
+	applied, err := m.Migrate(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect := []string{
+		"001-first.sql",
+		"002-second.sql",
+	}
+
+	if diff := cmp.Diff(expect, applied); diff != "" {
+		t.Errorf("applied migrations differ (-want +got):\n%s", diff)
+	}
+}
+
+func TestWithRepeatablePrefix(t *testing.T) {
+	db := sqlitetest.NewDB(t)
+	fsys := fstest.MapFS{
+		"001-first.sql":  {Data: []byte("CREATE TABLE runs (version TEXT);")},
+		"R__record.sql":  {Data: []byte("INSERT INTO runs (version) VALUES ('one');")},
+		"002-second.sql": {Data: []byte("CREATE TABLE data (id INTEGER);")},
+	}
+
+	m := flit.New(db, fsys, flit.WithRepeatablePrefix("R__"), flit.WithChecksumVerification(true))
+
+	runs := []struct {
+		content string
+		expect  []string
+	}{
+		{"INSERT INTO runs (version) VALUES ('one');", []string{"001-first.sql", "002-second.sql", "R__record.sql"}},
+		{"INSERT INTO runs (version) VALUES ('one');", nil},
+		{"INSERT INTO runs (version) VALUES ('two');", []string{"R__record.sql"}},
+	}
+
+	for i, run := range runs {
+		fsys["R__record.sql"].Data = []byte(run.content)
+		applied, err := m.Migrate(t.Context())
+		if err != nil {
+			t.Fatalf("run %d: %v", i, err)
+		}
+
+		if diff := cmp.Diff(run.expect, applied); diff != "" {
+			t.Errorf("run %d: applied migrations differ (-want +got):\n%s", i, diff)
+		}
+	}
+
+	rows, err := db.QueryContext(t.Context(), "SELECT version FROM runs")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer rows.Close()
+
+	var versions []string
+	for rows.Next() {
+		var v string
+		if err := rows.Scan(&v); err != nil {
+			t.Fatal(err)
+		}
+
+		versions = append(versions, v)
+	}
+
+	if diff := cmp.Diff([]string{"one", "two"}, versions); diff != "" {
+		t.Errorf("repeatable runs differ (-want +got):\n%s", diff)
+	}
+}
+
+func TestWithTemplateData(t *testing.T) {
+	fsys := fstest.MapFS{
+		"001-first.sql":  {Data: []byte("CREATE TABLE {{.Table}} (id INTEGER);")},
+		"002-second.sql": {Data: []byte("INSERT INTO {{.Table}} (id) VALUES (1);")},
+	}
+
+	checksums := make(map[string]string)
+	for _, table := range []string{"alpha", "beta"} {
+		db := sqlitetest.NewDB(t)
+		m := flit.New(db, fsys, flit.WithTemplateData(map[string]any{"Table": table}))
+		if _, err := m.Migrate(t.Context()); err != nil {
+			t.Fatal(err)
+		}
+
+		var count int
+		if err := db.QueryRowContext(t.Context(), "SELECT COUNT(*) FROM "+table).Scan(&count); err != nil {
+			t.Fatal(err)
+		}
+
+		if count != 1 {
+			t.Errorf("%s: expected 1 row, got %d", table, count)
+		}
+
+		var checksum string
+		if err := db.QueryRowContext(t.Context(), "SELECT checksum FROM flits WHERE name = '001-first.sql'").Scan(&checksum); err != nil {
+			t.Fatal(err)
+		}
+
+		checksums[table] = checksum
+	}
+
+	if checksums["alpha"] == checksums["beta"] {
+		t.Error("expected checksums of differently rendered migrations to differ")
+	}
+}
+
+func TestWithTemplateDataMissingKey(t *testing.T) {
+	db := sqlitetest.NewDB(t)
+	fsys := fstest.MapFS{
+		"001-first.sql": {Data: []byte("CREATE TABLE {{.Table}} (id INTEGER);")},
+	}
+
+	m := flit.New(db, fsys, flit.WithTemplateData(map[string]any{}))
+	if _, err := m.Migrate(t.Context()); err == nil || !strings.Contains(err.Error(), "render 001-first.sql") {
+		t.Errorf("expected a render error, got %v", err)
+	}
+}
+
+func TestDirty(t *testing.T) {
+	db := sqlitetest.NewDB(t)
+	fsys := fstest.MapFS{
+		"001-first.sql":  {Data: []byte("CREATE TABLE data (id INTEGER);")},
+		"002-second.sql": {Data: []byte("INSERT INTO data (id) VALUES (1);\nINSERT INTO missing (id) VALUES (1);")},
+		"003-third.sql":  {Data: []byte("INSERT INTO data (id) VALUES (3);")},
+	}
+
+	m := flit.New(db, fsys)
+	if _, err := m.Migrate(t.Context()); err == nil || errors.Is(err, flit.ErrDirty) {
+		t.Fatalf("expected the migration to fail, got %v", err)
+	}
+
+	fsys["002-second.sql"].Data = []byte("INSERT INTO data (id) VALUES (2);")
+	applied, err := m.Migrate(t.Context())
+	if !errors.Is(err, flit.ErrDirty) || !strings.Contains(err.Error(), "002-second.sql") {
+		t.Errorf("expected ErrDirty naming 002-second.sql, got %v", err)
+	}
+
+	if len(applied) != 0 {
+		t.Errorf("expected no migrations to be applied, got %v", applied)
+	}
+
+	status, err := m.Status(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect := &flit.Status{
+		Applied: []string{"001-first.sql"},
+		Pending: []string{"003-third.sql"},
+		Dirty:   []string{"002-second.sql"},
+	}
+
+	if diff := cmp.Diff(expect, status, cmpopts.IgnoreFields(flit.Status{}, "AppliedAt")); diff != "" {
+		t.Errorf("status differs (-want +got):\n%s", diff)
+	}
+}
+
+func TestDirtyWithTransactions(t *testing.T) {
+	db := sqlitetest.NewDB(t)
+	fsys := fstest.MapFS{
+		"001-first.sql": {Data: []byte("CREATE TABLE data (id INTEGER);\nINSERT INTO missing (id) VALUES (1);")},
+	}
+
+	m := flit.New(db, fsys, flit.WithTransactions())
+	if _, err := m.Migrate(t.Context()); err == nil {
+		t.Fatal("expected the migration to fail")
+	}
+
+	fsys["001-first.sql"].Data = []byte("CREATE TABLE data (id INTEGER);")
+	if _, err := m.Migrate(t.Context()); err != nil {
+		t.Errorf("expected a rolled back migration to leave the database clean, got %v", err)
+	}
+}
+
+func TestRepair(t *testing.T) {
+	db := sqlitetest.NewDB(t)
+	fsys := fstest.MapFS{
+		"001-first.sql":  {Data: []byte("CREATE TABLE data (id INTEGER);")},
+		"002-second.sql": {Data: []byte("INSERT INTO missing (id) VALUES (1);")},
+	}
+
+	var buf strings.Builder
+	logger := slog.New(slog.NewTextHandler(&buf, nil))
+	m := flit.New(db, fsys, flit.WithChecksumVerification(true), flit.WithLogger(logger))
+	if _, err := m.Migrate(t.Context()); err == nil {
+		t.Fatal("expected the migration to fail")
+	}
+
+	// fix both migrations by hand
+	fsys["001-first.sql"].Data = []byte("CREATE TABLE data (id INTEGER, name TEXT);")
+	fsys["002-second.sql"].Data = []byte("INSERT INTO data (id) VALUES (1);")
+	if _, err := db.Exec("ALTER TABLE data ADD COLUMN name TEXT"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.Repair(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, msg := range []string{
+		`msg="flit: removed dirty migration" name=002-second.sql`,
+		`msg="flit: rewrote checksum" name=001-first.sql`,
+	} {
+		if !strings.Contains(buf.String(), msg) {
+			t.Errorf("expected log to contain %q:\n%s", msg, buf.String())
+		}
+	}
+
+	applied, err := m.Migrate(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := cmp.Diff([]string{"002-second.sql"}, applied); diff != "" {
+		t.Errorf("applied migrations differ (-want +got):\n%s", diff)
+	}
+}
+
+func TestBaselineDirty(t *testing.T) {
+	db := sqlitetest.NewDB(t)
+	fsys := fstest.MapFS{
+		"001-first.sql":  {Data: []byte("CREATE TABLE data (id INTEGER);")},
+		"002-second.sql": {Data: []byte("INSERT INTO data (id) VALUES (2);\nINSERT INTO missing (id) VALUES (2);")},
+		"003-third.sql":  {Data: []byte("INSERT INTO data (id) VALUES (3);")},
+	}
+
+	m := flit.New(db, fsys)
+	if _, err := m.Migrate(t.Context()); err == nil {
+		t.Fatal("expected the migration to fail")
+	}
+
+	// the failed migration was completed by hand
+	if err := m.Baseline(t.Context(), "002-second.sql"); err != nil {
+		t.Fatal(err)
+	}
+
+	applied, err := m.Migrate(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := cmp.Diff([]string{"003-third.sql"}, applied); diff != "" {
+		t.Errorf("applied migrations differ (-want +got):\n%s", diff)
+	}
+}
+
+func TestChainGuards(t *testing.T) {
+	type key string
+
+	var events []string
+	guard := func(name string) flit.GuardFunc {
+		return func(ctx context.Context, conn *sql.Conn, f func(context.Context, *sql.Conn) error) error {
+			events = append(events, "acquire "+name)
+			defer func() {
+				events = append(events, "release "+name)
+			}()
+
+			return f(context.WithValue(ctx, key(name), true), conn)
+		}
+	}
+
+	db := sqlitetest.NewDB(t)
+	m := flit.New(db, os.DirFS("testdata/example"),
+		flit.WithGuard(flit.ChainGuards(flit.GuardMutex(), guard("outer"), guard("inner"))),
+		flit.WithBeforeEach(func(ctx context.Context, name string) error {
+			if ctx.Value(key("outer")) == nil || ctx.Value(key("inner")) == nil {
+				t.Error("expected the context of both guards")
+			}
+
+			events = append(events, "apply "+name)
+			return nil
+		}),
+	)
+
+	if _, err := m.Migrate(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+
+	expect := []string{
+		"acquire outer",
+		"acquire inner",
+		"apply 001-first.sql",
+		"apply 002-second.sql",
+		"release inner",
+		"release outer",
+	}
+
+	if diff := cmp.Diff(expect, events); diff != "" {
+		t.Errorf("events differ (-want +got):\n%s", diff)
+	}
+}
+
+func TestWithContinueOnError(t *testing.T) {
+	db := sqlitetest.NewDB(t)
+	fsys := fstest.MapFS{
+		"001-first.sql":  {Data: []byte("CREATE TABLE data (id INTEGER);")},
+		"002-second.sql": {Data: []byte("INSERT INTO missing (id) VALUES (2);")},
+		"003-third.sql":  {Data: []byte("INSERT INTO data (id) VALUES (3);")},
+	}
+
+	m := flit.New(db, fsys, flit.WithContinueOnError(), flit.WithTransactions())
+	applied, err := m.Migrate(t.Context())
+	if err == nil || !strings.Contains(err.Error(), "apply 002-second.sql") {
+		t.Errorf("expected an error for 002-second.sql, got %v", err)
+	}
+
+	if diff := cmp.Diff([]string{"001-first.sql", "003-third.sql"}, applied); diff != "" {
+		t.Errorf("applied migrations differ (-want +got):\n%s", diff)
+	}
+
+	pending, err := m.Pending(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := cmp.Diff([]string{"002-second.sql"}, pending); diff != "" {
+		t.Errorf("pending migrations differ (-want +got):\n%s", diff)
+	}
+}
+
+func TestWithSingleTransaction(t *testing.T) {
+	db := sqlitetest.NewDB(t)
+	fsys := fstest.MapFS{
+		"001-first.sql":  {Data: []byte("CREATE TABLE data (id INTEGER);")},
+		"002-second.sql": {Data: []byte("INSERT INTO data (id) VALUES (2);")},
+		"003-third.sql":  {Data: []byte("INSERT INTO missing (id) VALUES (3);")},
+	}
+
+	m := flit.New(db, fsys, flit.WithSingleTransaction(), flit.WithContinueOnError())
+	applied, err := m.Migrate(t.Context())
+	if err == nil || !strings.Contains(err.Error(), "apply 003-third.sql") {
+		t.Errorf("expected an error for 003-third.sql, got %v", err)
+	}
+
+	if len(applied) != 0 {
+		t.Errorf("expected no applied migrations, got %v", applied)
+	}
+
+	// the first two migrations were rolled back
+	if _, err := db.Exec("SELECT id FROM data"); err == nil {
+		t.Error("expected the data table not to exist")
+	}
+
+	pending, err := m.Pending(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := cmp.Diff([]string{"001-first.sql", "002-second.sql", "003-third.sql"}, pending); diff != "" {
+		t.Errorf("pending migrations differ (-want +got):\n%s", diff)
+	}
+
+	fsys["003-third.sql"] = &fstest.MapFile{Data: []byte("INSERT INTO data (id) VALUES (3);")}
+	applied, err = m.Migrate(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := cmp.Diff([]string{"001-first.sql", "002-second.sql", "003-third.sql"}, applied); diff != "" {
+		t.Errorf("applied migrations differ (-want +got):\n%s", diff)
+	}
+}
+
+func TestWithSingleTransactionNoTransaction(t *testing.T) {
+	db := sqlitetest.NewDB(t)
+	fsys := fstest.MapFS{
+		"001-first.sql":  {Data: []byte("CREATE TABLE data (id INTEGER);")},
+		"002-second.sql": {Data: []byte("-- flit:no-transaction\nINSERT INTO data (id) VALUES (2);")},
+	}
+
+	m := flit.New(db, fsys, flit.WithSingleTransaction())
+	if _, err := m.Migrate(t.Context()); err == nil || !strings.Contains(err.Error(), "can't run in a single transaction") {
+		t.Errorf("expected an error for 002-second.sql, got %v", err)
+	}
+
+	if _, err := db.Exec("SELECT id FROM data"); err == nil {
+		t.Error("expected the data table not to exist")
+	}
+}
+
+func TestOwnTransaction(t *testing.T) {
+	for _, begin := range []string{
+		"begin;",
+		"-- the migration's own transaction\nBEGIN TRANSACTION;",
+		"/* immediate\n   transaction */ BEGIN IMMEDIATE;",
+	} {
+		db := sqlitetest.NewDB(t)
+		fsys := fstest.MapFS{
+			"001-first.sql": {Data: []byte(begin + "\nCREATE TABLE data (id INTEGER);\nCOMMIT;")},
+		}
+
+		if _, err := flit.New(db, fsys, flit.WithTransactions()).Migrate(t.Context()); err != nil {
+			t.Errorf("%q: %v", begin, err)
+		}
+	}
+}
+
+func TestNoTransactionDirective(t *testing.T) {
+	for name, data := range map[string]string{
+		"first line":      "-- flit:no-transaction\nCREATE TABLE data (id INTEGER);\nINSERT INTO missing (id) VALUES (1);",
+		"header comments": "-- 001-first\n-- Created 2024-01-02T03:04:05Z\n-- flit:no-transaction\n\nCREATE TABLE data (id INTEGER);\nINSERT INTO missing (id) VALUES (1);",
+		"after up marker": "-- 001-first\n-- Created 2024-01-02T03:04:05Z\n\n-- +flit Up\n-- flit:no-transaction\nCREATE TABLE data (id INTEGER);\nINSERT INTO missing (id) VALUES (1);\n\n-- +flit Down\nDROP TABLE data;\n",
+	} {
+		t.Run(name, func(t *testing.T) {
+			db := sqlitetest.NewDB(t)
+			fsys := fstest.MapFS{"001-first.sql": {Data: []byte(data)}}
+
+			m := flit.New(db, fsys, flit.WithTransactions())
+			if _, err := m.Migrate(t.Context()); err == nil {
+				t.Fatal("expected the migration to fail")
+			}
+
+			// the first statement wasn't rolled back
+			if _, err := db.Exec("INSERT INTO data (id) VALUES (1)"); err != nil {
+				t.Errorf("expected the data table to exist: %v", err)
+			}
+
+			if _, err := m.Migrate(t.Context()); !errors.Is(err, flit.ErrDirty) {
+				t.Errorf("expected ErrDirty, got %v", err)
+			}
+		})
+	}
+}
+
+func TestNoTransactionDirectiveAfterStatement(t *testing.T) {
+	db := sqlitetest.NewDB(t)
+	fsys := fstest.MapFS{
+		"001-first.sql": {Data: []byte("CREATE TABLE data (id INTEGER);\n-- flit:no-transaction\nINSERT INTO missing (id) VALUES (1);")},
+	}
+
+	m := flit.New(db, fsys, flit.WithTransactions())
+	if _, err := m.Migrate(t.Context()); err == nil {
+		t.Fatal("expected the migration to fail")
+	}
+
+	// the directive after the first statement is ignored, so the migration was rolled back
+	if _, err := db.Exec("INSERT INTO data (id) VALUES (1)"); err == nil {
+		t.Error("expected the data table not to exist")
+	}
+}
+
+func TestWithSkipEmpty(t *testing.T) {
+	db := sqlitetest.NewDB(t)
+	fsys := fstest.MapFS{
+		"001-first.sql":  {Data: []byte("CREATE TABLE data (id INTEGER);")},
+		"002-second.sql": {Data: []byte("-- 002-second\n\n")},
+		"003-third.sql":  {Data: []byte("INSERT INTO data (id) VALUES (3);")},
+	}
+
+	var buf strings.Builder
+	m := flit.New(db, fsys, flit.WithSkipEmpty(), flit.WithLogger(slog.New(slog.NewTextHandler(&buf, nil))))
+	applied, err := m.Migrate(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := cmp.Diff([]string{"001-first.sql", "003-third.sql"}, applied); diff != "" {
+		t.Errorf("applied migrations differ (-want +got):\n%s", diff)
+	}
+
+	if msg := `msg="flit: skipped empty migration" name=002-second.sql`; !strings.Contains(buf.String(), msg) {
+		t.Errorf("expected log to contain %q:\n%s", msg, buf.String())
+	}
+
+	fsys["002-second.sql"].Data = []byte("INSERT INTO data (id) VALUES (2);")
+	applied, err = m.Migrate(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := cmp.Diff([]string{"002-second.sql"}, applied); diff != "" {
+		t.Errorf("applied migrations differ (-want +got):\n%s", diff)
+	}
+}
+
+func TestWithNamePattern(t *testing.T) {
+	db := sqlitetest.NewDB(t)
+	m := flit.New(db, os.DirFS("testdata/example"), flit.WithNamePattern(regexp.MustCompile(flit.DefaultNamePattern)))
+	if _, err := m.Migrate(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+
+	fsys := fstest.MapFS{
+		"001-first.sql": {Data: []byte("CREATE TABLE data (id INTEGER);")},
+		"first.sql":     {Data: []byte("CREATE TABLE other (id INTEGER);")},
+	}
+
+	m = flit.New(sqlitetest.NewDB(t), fsys, flit.WithNamePattern(regexp.MustCompile(flit.DefaultNamePattern)))
+	if _, err := m.Migrate(t.Context()); err == nil || !strings.Contains(err.Error(), "migration first.sql doesn't match") {
+		t.Errorf("expected an error naming first.sql, got %v", err)
+	}
+}
+
+func TestWithUniqueVersions(t *testing.T) {
+	db := sqlitetest.NewDB(t)
+	fsys := fstest.MapFS{
+		"001-a.sql": {Data: []byte("CREATE TABLE a (id INTEGER);")},
+		"001-b.sql": {Data: []byte("CREATE TABLE b (id INTEGER);")},
+	}
+
+	m := flit.New(db, fsys, flit.WithUniqueVersions())
+	if _, err := m.Migrate(t.Context()); err == nil || !strings.Contains(err.Error(), "001-a.sql and 001-b.sql") {
+		t.Errorf("expected an error naming both files, got %v", err)
+	}
+
+	// by default the files are applied in name order
+	m = flit.New(db, fsys)
+	if _, err := m.Migrate(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWithNoGaps(t *testing.T) {
+	sql := []byte("SELECT 1;")
+	tests := []struct {
+		names   []string
+		missing string
+	}{
+		{[]string{"0001-a.sql", "0002-b.sql", "0003-c.sql"}, ""},
+		{[]string{"0001-a.sql", "0002-b.sql", "0004-d.sql", "0007-g.sql"}, "missing migration versions 3, 5, 6"},
+		{[]string{"20240101000000-a.sql", "20240301000000-b.sql"}, ""},
+		{[]string{"0001-a.sql", "0003-c.sql", "R__views.sql"}, "missing migration versions 2"},
+	}
+
+	for _, test := range tests {
+		fsys := make(fstest.MapFS)
+		for _, name := range test.names {
+			fsys[name] = &fstest.MapFile{Data: sql}
+		}
+
+		m := flit.New(sqlitetest.NewDB(t), fsys, flit.WithNoGaps(), flit.WithRepeatablePrefix("R__"))
+		_, err := m.Migrate(t.Context())
+		if test.missing == "" && err != nil {
+			t.Errorf("%v: unexpected error: %v", test.names, err)
+		}
+
+		if test.missing != "" && (err == nil || err.Error() != test.missing) {
+			t.Errorf("%v: expected error %q, got %v", test.names, test.missing, err)
+		}
+	}
+}
+
+func TestMigrateCancel(t *testing.T) {
+	db := sqlitetest.NewDB(t)
+	ctx, cancel := context.WithCancel(t.Context())
+	defer cancel()
+
+	m := flit.New(db, os.DirFS("testdata/example"), flit.WithAfterEach(func(context.Context, string, error) error {
+		cancel()
+		return nil
+	}))
+
+	applied, err := m.Migrate(ctx)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+
+	if diff := cmp.Diff([]string{"001-first.sql"}, applied); diff != "" {
+		t.Errorf("applied migrations differ (-want +got):\n%s", diff)
+	}
+}
+
+func TestWithTimeout(t *testing.T) {
+	db := sqlitetest.NewDB(t)
+	m := flit.New(db, os.DirFS("testdata/example"),
+		flit.WithTimeout(50*time.Millisecond),
+		flit.WithBeforeEach(func(ctx context.Context, name string) error {
+			if name != "002-second.sql" {
+				return nil
+			}
+
+			// stall until the timeout expires
+			<-ctx.Done()
+			return ctx.Err()
+		}),
+	)
+
+	applied, err := m.Migrate(t.Context())
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected context.DeadlineExceeded, got %v", err)
+	}
+
+	for _, msg := range []string{"timed out after 50ms", "002-second.sql"} {
+		if err == nil || !strings.Contains(err.Error(), msg) {
+			t.Errorf("expected the error to contain %q, got %v", msg, err)
+		}
+	}
+
+	if diff := cmp.Diff([]string{"001-first.sql"}, applied); diff != "" {
+		t.Errorf("applied migrations differ (-want +got):\n%s", diff)
+	}
+}
+
+func TestMigrations(t *testing.T) {
+	fsys := fstest.MapFS{
+		"002-second.sql": {Data: []byte("INSERT INTO data (id) VALUES (1);")},
+		"001-first.sql":  {Data: []byte("CREATE TABLE data (id INTEGER);")},
+	}
+
+	// the database isn't accessed
+	migrations, err := flit.New(nil, fsys).Migrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect := []flit.Migration{
+		{Name: "001-first.sql", Sum: fmt.Sprintf("%x", sha256.Sum256([]byte("001-first.sql"))), SQL: "CREATE TABLE data (id INTEGER);"},
+		{Name: "002-second.sql", Sum: fmt.Sprintf("%x", sha256.Sum256([]byte("002-second.sql"))), SQL: "INSERT INTO data (id) VALUES (1);"},
+	}
+
+	if diff := cmp.Diff(expect, migrations); diff != "" {
+		t.Errorf("migrations differ (-want +got):\n%s", diff)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	db := sqlitetest.NewDB(t)
+	fsys := fstest.MapFS{
+		"001-first.sql":  {Data: []byte("CREATE TABLE data (id INTEGER);")},
+		"002-second.sql": {Data: []byte("INSERT INTO data (id) VALUES (2);")},
+	}
+
+	m := flit.New(db, fsys)
+	if err := m.Verify(t.Context()); !errors.Is(err, flit.ErrPending) {
+		t.Errorf("expected ErrPending before migrating, got %v", err)
+	}
+
+	if _, err := m.Migrate(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.Verify(t.Context()); err != nil {
+		t.Errorf("expected the database to match, got %v", err)
+	}
+
+	fsys["001-first.sql"].Data = []byte("CREATE TABLE data (id INTEGER, name TEXT);")
+	delete(fsys, "002-second.sql")
+	fsys["003-third.sql"] = &fstest.MapFile{Data: []byte("SELECT 1;")}
+
+	err := m.Verify(t.Context())
+	for _, target := range []error{flit.ErrChecksumMismatch, flit.ErrOrphanedMigration, flit.ErrPending} {
+		if !errors.Is(err, target) {
+			t.Errorf("expected the error to wrap %v, got %v", target, err)
+		}
+	}
+}
+
+// countingDB is a flit.DB that counts the connections acquired from a *sql.DB.
+type countingDB struct {
+	*sql.DB
+	conns int
+}
+
+func (db *countingDB) Conn(ctx context.Context) (*sql.Conn, error) {
+	db.conns++
+	return db.DB.Conn(ctx)
+}
+
+func TestDBInterface(t *testing.T) {
+	db := &countingDB{DB: sqlitetest.NewDB(t)}
+	m := flit.New(db, os.DirFS("testdata/example"))
+	if _, err := m.Migrate(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := m.Status(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+
+	if db.conns != 2 {
+		t.Errorf("expected 2 connections, got %d", db.conns)
+	}
+}
+
+// flakyDB is a flit.DB that fails to acquire its first failures connections.
+type flakyDB struct {
+	*sql.DB
+	failures int
+	conns    int
+}
+
+func (db *flakyDB) Conn(ctx context.Context) (*sql.Conn, error) {
+	db.conns++
+	if db.conns <= db.failures {
+		return nil, driver.ErrBadConn
+	}
+
+	return db.DB.Conn(ctx)
+}
+
+func TestWithRetry(t *testing.T) {
+	db := &flakyDB{DB: sqlitetest.NewDB(t), failures: 2}
+	m := flit.New(db, os.DirFS("testdata/example"), flit.WithRetry(3, time.Millisecond))
+	applied, err := m.Migrate(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := cmp.Diff([]string{"001-first.sql", "002-second.sql"}, applied); diff != "" {
+		t.Errorf("applied migrations differ (-want +got):\n%s", diff)
+	}
+
+	if db.conns != 3 {
+		t.Errorf("expected 3 connections, got %d", db.conns)
+	}
+}
+
+func TestWithRetryExhausted(t *testing.T) {
+	db := &flakyDB{DB: sqlitetest.NewDB(t), failures: 3}
+	m := flit.New(db, os.DirFS("testdata/example"), flit.WithRetry(2, time.Millisecond))
+	_, err := m.Migrate(t.Context())
+	if !errors.Is(err, driver.ErrBadConn) || !strings.Contains(err.Error(), "failed after 2 attempts") {
+		t.Errorf("expected ErrBadConn after 2 attempts, got %v", err)
+	}
+}
+
+func TestWithRetryIf(t *testing.T) {
+	db := &flakyDB{DB: sqlitetest.NewDB(t), failures: 1}
+	m := flit.New(db, os.DirFS("testdata/example"), flit.WithRetry(3, time.Millisecond), flit.WithRetryIf(func(error) bool {
+		return false
+	}))
+
+	if _, err := m.Migrate(t.Context()); !errors.Is(err, driver.ErrBadConn) {
+		t.Errorf("expected ErrBadConn, got %v", err)
+	}
+
+	if db.conns != 1 {
+		t.Errorf("expected 1 connection, got %d", db.conns)
+	}
+}
+
+func TestWithRetryAfterExecuting(t *testing.T) {
+	db := sqlitetest.NewDB(t)
+	m := flit.New(db, fstest.MapFS{}, flit.WithRetry(3, time.Millisecond))
+	calls := 0
+	m.Register("001-go", func(context.Context, *sql.Conn) error {
+		calls++
+		return driver.ErrBadConn
+	})
+
+	// the function may have changed the database, so it isn't retried
+	_, err := m.Migrate(t.Context())
+	if !errors.Is(err, driver.ErrBadConn) || errors.Is(err, flit.ErrDirty) || strings.Contains(err.Error(), "attempts") {
+		t.Errorf("expected the original ErrBadConn, got %v", err)
+	}
+
+	if calls != 1 {
+		t.Errorf("expected 1 call, got %d", calls)
+	}
+}
+
+func TestWithProgress(t *testing.T) {
+	db := sqlitetest.NewDB(t)
+	fsys := fstest.MapFS{
+		"001-first.sql":  {Data: []byte("CREATE TABLE data (id INTEGER);")},
+		"002-second.sql": {Data: []byte("INSERT INTO data (id) VALUES (2);")},
+		"003-third.sql":  {Data: []byte("INSERT INTO data (id) VALUES (3);")},
+	}
+
+	if _, err := flit.New(db, fsys).MigrateTo(t.Context(), "001-first.sql"); err != nil {
+		t.Fatal(err)
+	}
+
+	var calls []string
+	m := flit.New(db, fsys, flit.WithProgress(func(done, total int, current string) {
+		calls = append(calls, fmt.Sprintf("%d/%d %s", done, total, current))
+	}))
+
+	if _, err := m.Migrate(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := cmp.Diff([]string{"0/2 002-second.sql", "1/2 003-third.sql"}, calls); diff != "" {
+		t.Errorf("progress calls differ (-want +got):\n%s", diff)
+	}
+}
+
+func TestMigrateConn(t *testing.T) {
+	db := &countingDB{DB: sqlitetest.NewDB(t)}
+	conn, err := db.DB.Conn(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer conn.Close()
+
+	// a temporary table is only visible to the session that created it
+	if _, err := conn.ExecContext(t.Context(), "CREATE TEMP TABLE session (id INTEGER)"); err != nil {
+		t.Fatal(err)
+	}
+
+	fsys := fstest.MapFS{
+		"001-first.sql": {Data: []byte("INSERT INTO session (id) VALUES (1);")},
+	}
+
+	applied, err := flit.New(db, fsys).MigrateConn(t.Context(), conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := cmp.Diff([]string{"001-first.sql"}, applied); diff != "" {
+		t.Errorf("applied migrations differ (-want +got):\n%s", diff)
+	}
+
+	if db.conns != 0 {
+		t.Errorf("expected no connections to be acquired, got %d", db.conns)
+	}
+
+	var n int
+	if err := conn.QueryRowContext(t.Context(), "SELECT COUNT(*) FROM session").Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+
+	if n != 1 {
+		t.Errorf("expected 1 row, got %d", n)
+	}
+}
+
+func TestWithObserver(t *testing.T) {
+	db := sqlitetest.NewDB(t)
+	fsys := fstest.MapFS{
+		"001-first.sql":  {Data: []byte("CREATE TABLE data (id INTEGER);")},
+		"002-second.sql": {Data: []byte("INSERT INTO missing (id) VALUES (2);")},
+	}
+
+	var events []flit.Event
+	m := flit.New(db, fsys, flit.WithObserver(func(event flit.Event) {
+		events = append(events, event)
+	}))
+
+	_, err := m.Migrate(t.Context())
+	if err == nil {
+		t.Fatal("expected the migration to fail")
+	}
+
+	type kindName struct {
+		Kind   flit.EventKind
+		Name   string
+		Failed bool
+	}
+
+	var got []kindName
+	for _, e := range events {
+		got = append(got, kindName{e.Kind, e.Name, e.Err != nil})
+	}
+
+	want := []kindName{
+		{flit.EventLockAcquired, "", false},
+		{flit.EventMigrationApplied, "001-first.sql", false},
+		{flit.EventMigrationApplied, "002-second.sql", true},
+		{flit.EventMigrateFinished, "", true},
+	}
+
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("events differ (-want +got):\n%s", diff)
+	}
+
+	if last := events[len(events)-1]; !errors.Is(last.Err, flit.ErrExec) || last.Duration <= 0 {
+		t.Errorf("expected the finished event to have the error and a duration, got %+v", last)
+	}
+}
+
+func TestWithHasher(t *testing.T) {
+	db := sqlitetest.NewDB(t)
+	m := flit.New(db, os.DirFS("testdata/example"), flit.WithHasher(md5.New))
+	if _, err := m.Migrate(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+
+	want := md5.Sum([]byte("001-first.sql"))
+	var n int
+	if err := db.QueryRow("SELECT COUNT(*) FROM flits WHERE sum = ?", hex.EncodeToString(want[:])).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+
+	if n != 1 {
+		t.Errorf("expected 001-first.sql to be recorded with its MD5 sum")
+	}
+
+	// the default hasher computes different sums
+	_, err := flit.New(db, os.DirFS("testdata/example")).Migrate(t.Context())
+	if err == nil || !strings.Contains(err.Error(), "created with a different hasher") {
+		t.Errorf("expected a hasher mismatch error, got %v", err)
+	}
+}
+
+func TestInclude(t *testing.T) {
+	db := sqlitetest.NewDB(t)
+	fsys := fstest.MapFS{
+		"001-first.sql":    {Data: []byte("-- flit:include shared/table.sql\nINSERT INTO data (id) VALUES (1);")},
+		"shared/table.sql": {Data: []byte("CREATE TABLE data (id INTEGER);\n-- flit:include shared/index.sql")},
+		"shared/index.sql": {Data: []byte("CREATE INDEX data_id ON data (id);")},
+	}
+
+	m := flit.New(db, fsys)
+	if _, err := m.Migrate(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+
+	var n int
+	if err := db.QueryRow("SELECT COUNT(*) FROM data INDEXED BY data_id").Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+
+	if n != 1 {
+		t.Errorf("expected 1 row, got %d", n)
+	}
+
+	if err := m.Verify(t.Context()); err != nil {
+		t.Errorf("expected the checksum to match before the included file changed: %v", err)
+	}
+
+	// changing an included file changes the migration
+	fsys["shared/index.sql"] = &fstest.MapFile{Data: []byte("CREATE UNIQUE INDEX data_id ON data (id);")}
+	if err := m.Verify(t.Context()); !errors.Is(err, flit.ErrChecksumMismatch) {
+		t.Errorf("expected ErrChecksumMismatch, got %v", err)
+	}
+}
+
+func TestIncludeCycle(t *testing.T) {
+	db := sqlitetest.NewDB(t)
+	fsys := fstest.MapFS{
+		"001-first.sql": {Data: []byte("-- flit:include shared/a.sql")},
+		"shared/a.sql":  {Data: []byte("-- flit:include shared/b.sql")},
+		"shared/b.sql":  {Data: []byte("-- flit:include shared/a.sql")},
+	}
+
+	_, err := flit.New(db, fsys).Migrate(t.Context())
+	want := "include shared/a.sql in shared/b.sql: cycle 001-first.sql -> shared/a.sql -> shared/b.sql -> shared/a.sql"
+	if err == nil || err.Error() != want {
+		t.Errorf("expected %q, got %v", want, err)
+	}
+}
+
+func TestWithNamespace(t *testing.T) {
+	db := sqlitetest.NewDB(t)
+	a := flit.New(db, fstest.MapFS{
+		"001-first.sql":  {Data: []byte("CREATE TABLE a (id INTEGER);")},
+		"002-second.sql": {Data: []byte("INSERT INTO a (id) VALUES (2);")},
+	}, flit.WithNamespace("a"), flit.WithStrictOrphans())
+
+	b := flit.New(db, fstest.MapFS{
+		"001-first.sql": {Data: []byte("CREATE TABLE b (id INTEGER);")},
+	}, flit.WithNamespace("b"), flit.WithStrictOrphans())
+
+	for _, m := range []*flit.Migrator{a, b, a} {
+		if _, err := m.Migrate(t.Context()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ignoreTimes := cmpopts.IgnoreFields(flit.Status{}, "AppliedAt")
+	status, err := b.Status(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := cmp.Diff(&flit.Status{Applied: []string{"001-first.sql"}}, status, ignoreTimes); diff != "" {
+		t.Errorf("status of b differs (-want +got):\n%s", diff)
+	}
+
+	var namespaces []string
+	rows, err := db.Query("SELECT namespace FROM flits ORDER BY namespace")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer rows.Close()
+	for rows.Next() {
+		var namespace string
+		if err := rows.Scan(&namespace); err != nil {
+			t.Fatal(err)
+		}
+
+		namespaces = append(namespaces, namespace)
+	}
+
+	if diff := cmp.Diff([]string{"a", "a", "b"}, namespaces); diff != "" {
+		t.Errorf("recorded namespaces differ (-want +got):\n%s", diff)
+	}
+
+	// the default namespace is separate too
+	pending, err := flit.New(db, os.DirFS("testdata/example")).Pending(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := cmp.Diff([]string{"001-first.sql", "002-second.sql"}, pending); diff != "" {
+		t.Errorf("pending migrations differ (-want +got):\n%s", diff)
+	}
+}
+
+func TestDefaultGuardSharedByDB(t *testing.T) {
+	db := sqlitetest.NewDB(t)
+	fsys := fstest.MapFS{
+		"001-first.sql":  {Data: []byte("SELECT 1;")},
+		"002-second.sql": {Data: []byte("SELECT 2;")},
+	}
+
+	var active, overlaps atomic.Int32
+	before := flit.WithBeforeEach(func(ctx context.Context, name string) error {
+		if active.Add(1) > 1 {
+			overlaps.Add(1)
+		}
+
+		time.Sleep(10 * time.Millisecond)
+		return nil
+	})
+
+	after := flit.WithAfterEach(func(ctx context.Context, name string, err error) error {
+		active.Add(-1)
+		return err
+	})
+
+	var wg sync.WaitGroup
+	for _, namespace := range []string{"a", "b"} {
+		m := flit.New(db, fsys, flit.WithNamespace(namespace), before, after)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := m.Migrate(t.Context()); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+
+	wg.Wait()
+	if n := overlaps.Load(); n != 0 {
+		t.Errorf("expected the migrators not to apply migrations concurrently, %d overlapped", n)
+	}
+}
+
+// openCountingFS is an fs.FS that counts the files opened in it, by name.
+type openCountingFS struct {
+	fs.FS
+	opens map[string]int
+}
+
+func (fsys *openCountingFS) Open(name string) (fs.File, error) {
+	fsys.opens[name]++
+	return fsys.FS.Open(name)
+}
+
+func TestAppliedContentNotRead(t *testing.T) {
+	db := sqlitetest.NewDB(t)
+	fsys := &openCountingFS{FS: os.DirFS("testdata/example"), opens: make(map[string]int)}
+	m := flit.New(db, fsys)
+	if _, err := m.Migrate(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+
+	if fsys.opens["001-first.sql"] != 1 {
+		t.Errorf("expected 001-first.sql to be read once when it was applied, got %d", fsys.opens["001-first.sql"])
+	}
+
+	clear(fsys.opens)
+	if _, err := m.Migrate(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"001-first.sql", "002-second.sql"} {
+		if n := fsys.opens[name]; n != 0 {
+			t.Errorf("expected applied migration %s not to be read, it was opened %d times", name, n)
+		}
+	}
+}
+
+func TestChecksumStreamed(t *testing.T) {
+	db := sqlitetest.NewDB(t)
+	long := "-- " + strings.Repeat("-- flit:include shared/missing.sql ", 500) + "\n"
+	fsys := fstest.MapFS{
+		"001-first.sql":    {Data: []byte(long + "-- flit:include shared/table.sql\n" + long + "INSERT INTO data (id) VALUES (1);")},
+		"shared/table.sql": {Data: []byte("CREATE TABLE data (id INTEGER);")},
+	}
+
+	m := flit.New(db, fsys, flit.WithChecksumVerification(true))
+	if _, err := m.Migrate(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+
+	// the checksum of the applied migration is computed from the file as it's read
+	if _, err := m.Migrate(t.Context()); err != nil {
+		t.Error(err)
+	}
+
+	if err := m.Verify(t.Context()); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestWithCreateTable(t *testing.T) {
+	db := sqlitetest.NewDB(t)
+	m := flit.New(db, os.DirFS("testdata/example"), flit.WithCreateTable(false))
+	_, err := m.Migrate(t.Context())
+	if err == nil || !strings.Contains(err.Error(), "flits table doesn't exist") {
+		t.Errorf("expected an error for the missing table, got %v", err)
+	}
+
+	if _, err := db.Exec("SELECT * FROM flits"); err == nil {
+		t.Error("expected the flits table not to be created")
+	}
+
+	// a table created in advance is used
+	if _, err := flit.New(db, fstest.MapFS{}).Status(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+
+	applied, err := m.Migrate(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := cmp.Diff([]string{"001-first.sql", "002-second.sql"}, applied); diff != "" {
+		t.Errorf("applied migrations differ (-want +got):\n%s", diff)
+	}
+}
+
+func TestWithFS(t *testing.T) {
+	db := sqlitetest.NewDB(t)
+	options := []flit.ConfigOption{flit.WithTable("versions")}
+	m := flit.New(db, nil, append(options, flit.WithFS(os.DirFS("testdata/example")))...)
+	applied, err := m.Migrate(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := cmp.Diff([]string{"001-first.sql", "002-second.sql"}, applied); diff != "" {
+		t.Errorf("applied migrations differ (-want +got):\n%s", diff)
+	}
+
+	// the option overrides the positional file system
+	m = flit.New(db, os.DirFS("testdata/example"), append(options, flit.WithFS(fstest.MapFS{}))...)
+	pending, err := m.Pending(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(pending) != 0 {
+		t.Errorf("expected no pending migrations, got %v", pending)
+	}
+
+	status, err := m.Status(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(status.Orphans) != 2 {
+		t.Errorf("expected both applied migrations to be orphans, got %v", status.Orphans)
+	}
+}
+
+func TestNoFS(t *testing.T) {
+	db := sqlitetest.NewDB(t)
+	for _, m := range []*flit.Migrator{
+		flit.New(db, nil),
+		flit.New(db, fstest.MapFS{}, flit.WithAdditionalFS(nil)),
+		flit.NewWithSource(db, nil),
+	} {
+		if _, err := m.Migrate(t.Context()); err == nil || !strings.Contains(err.Error(), "no migration file system") {
+			t.Errorf("expected an error for the missing file system, got %v", err)
+		}
+
+		if _, err := m.Plan(t.Context()); err == nil || !strings.Contains(err.Error(), "no migration file system") {
+			t.Errorf("expected an error for the missing file system, got %v", err)
+		}
+	}
+}
+
+func TestGuardWrongDriver(t *testing.T) {
+	db := sqlitetest.NewDB(t)
+	for name, guard := range map[string]flit.GuardFunc{
+		"mysql":    flit.GuardMySQL,
+		"postgres": flit.GuardPostgres,
+		"mssql":    flit.GuardMSSQL,
+	} {
+		m := flit.New(db, os.DirFS("testdata/example"), flit.WithGuard(guard))
+		_, err := m.Migrate(t.Context())
+		want := "the " + name + " guard can't be used with a sqlite database"
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: expected error containing %q, got %v", name, want, err)
+		}
+	}
+}
+
+func TestWithMetadata(t *testing.T) {
+	db := sqlitetest.NewDB(t)
+	m := flit.New(db, os.DirFS("testdata/example"), flit.WithMetadata(map[string]string{"version": "1.2.0", "commit": "abc123"}))
+	if _, err := m.Migrate(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+
+	var metadata string
+	if err := db.QueryRow("SELECT metadata FROM flits WHERE name = '001-first.sql'").Scan(&metadata); err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := cmp.Diff(`{"commit":"abc123","version":"1.2.0"}`, metadata); diff != "" {
+		t.Errorf("metadata differs (-want +got):\n%s", diff)
+	}
+
+	// migrations recorded without metadata have none
+	m = flit.New(db, fstest.MapFS{"003-third.sql": {Data: []byte("CREATE TABLE third (id INTEGER);")}})
+	if _, err := m.Migrate(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+
+	var none sql.NullString
+	if err := db.QueryRow("SELECT metadata FROM flits WHERE name = '003-third.sql'").Scan(&none); err != nil {
+		t.Fatal(err)
+	}
+
+	if none.Valid {
+		t.Errorf("expected no metadata, got %s", none.String)
+	}
+}
+
+// valueDB is a database that isn't a pointer, and whose value can't be hashed.
+type valueDB struct {
+	flit.DB
+	tags any
+}
+
+func TestDefaultGuardValueDB(t *testing.T) {
+	db := valueDB{DB: sqlitetest.NewDB(t), tags: map[string]int{"a": 1}}
+	applied, err := flit.New(db, os.DirFS("testdata/example")).Migrate(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := cmp.Diff([]string{"001-first.sql", "002-second.sql"}, applied); diff != "" {
+		t.Errorf("applied migrations differ (-want +got):\n%s", diff)
+	}
 }
@@ -0,0 +1,87 @@
+package flit
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// GuardMutex returns a guard function that serializes migrations in this process with a mutex,
+// like the default guard. It is useful with [ChainGuards].
+// Each call returns a guard with its own mutex.
+func GuardMutex() GuardFunc {
+	return new(mutexGuard).Guard
+}
+
+// ChainGuards returns a guard function that nests the given guards, in order.
+// The first guard is acquired first and released last;
+// each guard calls the next one with the context and connection it was called with,
+// and the last guard calls f.
+// For example, ChainGuards(GuardMutex(), GuardMySQL) serializes migrations in this process
+// before taking the MySQL lock, so only one connection per process waits for it.
+// With no guards, the returned guard function calls f directly.
+func ChainGuards(guards ...GuardFunc) GuardFunc {
+	return func(ctx context.Context, conn *sql.Conn, f func(context.Context, *sql.Conn) error) error {
+		if len(guards) == 0 {
+			return f(ctx, conn)
+		}
+
+		return guards[0](ctx, conn, func(ctx context.Context, conn *sql.Conn) error {
+			return ChainGuards(guards[1:]...)(ctx, conn, f)
+		})
+	}
+}
+
+// releaseTimeout limits how long a guard waits to release its lock.
+const releaseTimeout = 10 * time.Second
+
+// releaseContext returns the context a guard releases its lock with.
+// It isn't cancelled when ctx is, because the database driver doesn't send statements on a done context,
+// so a lock held when a migration times out or is cancelled would stay held by the pooled session.
+func releaseContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.WithoutCancel(ctx), releaseTimeout)
+}
+
+// driverDatabases maps the package paths of well-known drivers to the database they connect to.
+var driverDatabases = map[string]string{
+	"github.com/go-sql-driver/mysql":   "mysql",
+	"github.com/lib/pq":                "postgres",
+	"github.com/jackc/pgx":             "postgres",
+	"github.com/mattn/go-sqlite3":      "sqlite",
+	"modernc.org/sqlite":               "sqlite",
+	"github.com/microsoft/go-mssqldb":  "mssql",
+	"github.com/denisenkom/go-mssqldb": "mssql",
+}
+
+// checkDriver returns an error if conn's driver is known to connect to a database other than want,
+// which is the database a guard requires. It is a best-effort check:
+// connections from unknown or wrapping drivers are assumed to be correct,
+// and fail later if they aren't.
+func checkDriver(conn *sql.Conn, want string) error {
+	var path string
+	if err := conn.Raw(func(dc any) error {
+		t := reflect.TypeOf(dc)
+		for t != nil && t.Kind() == reflect.Pointer {
+			t = t.Elem()
+		}
+
+		if t != nil {
+			path = t.PkgPath()
+		}
+
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	for pkg, got := range driverDatabases {
+		if (path == pkg || strings.HasPrefix(path, pkg+"/")) && got != want {
+			return fmt.Errorf("the %s guard can't be used with a %s database (driver %s); pass the guard for your database to WithGuard", want, got, pkg)
+		}
+	}
+
+	return nil
+}
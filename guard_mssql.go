@@ -0,0 +1,76 @@
+package flit
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"unicode/utf8"
+)
+
+// mssqlResourceLength is the maximum length of a SQL Server application lock resource name.
+const mssqlResourceLength = 255
+
+// GuardMSSQL manages migration concurrency with SQL Server's sp_getapplock and sp_releaseapplock procedures.
+// It gets an exclusive session lock on the resource "flit" before calling f and releases it after f returns.
+// GuardMSSQL blocks until the lock is acquired or ctx is done.
+// Flit's own statements use [DialectMSSQL], which is detected from the well-known SQL Server drivers.
+// Use this guard function by passing a [WithGuard] option to [New].
+func GuardMSSQL(ctx context.Context, conn *sql.Conn, f func(context.Context, *sql.Conn) error) error {
+	return guardMSSQL(ctx, conn, "flit", f)
+}
+
+// GuardMSSQLNamed returns a guard function like [GuardMSSQL] that locks the given resource instead of "flit".
+// The name must not be empty or longer than 255 characters;
+// if it is, the guard function returns an error without calling f.
+func GuardMSSQLNamed(name string) GuardFunc {
+	return func(ctx context.Context, conn *sql.Conn, f func(context.Context, *sql.Conn) error) error {
+		if n := utf8.RuneCountInString(name); n == 0 || n > mssqlResourceLength {
+			return fmt.Errorf("mssql lock resource %q must have 1 to %d characters", name, mssqlResourceLength)
+		}
+
+		return guardMSSQL(ctx, conn, name, f)
+	}
+}
+
+// guardMSSQL calls f while holding an exclusive session lock on the named resource.
+// The procedures return a negative code if they fail,
+// such as when the lock can't be granted or isn't held when released.
+func guardMSSQL(ctx context.Context, conn *sql.Conn, name string, f func(context.Context, *sql.Conn) error) (err error) {
+	if err := checkDriver(conn, "mssql"); err != nil {
+		return err
+	}
+
+	var code int
+	if err := conn.QueryRowContext(ctx, "DECLARE @code INT; EXEC @code = sp_getapplock @Resource = @resource, @LockMode = 'Exclusive', @LockOwner = 'Session', @LockTimeout = -1; SELECT @code", sql.Named("resource", name)).Scan(&code); err != nil {
+		return err
+	}
+
+	if code < 0 {
+		return fmt.Errorf("mssql lock %s: not acquired, sp_getapplock returned %d", name, code)
+	}
+
+	defer func() {
+		err = errors.Join(err, releaseMSSQL(ctx, conn, name))
+	}()
+
+	return f(ctx, conn)
+}
+
+// releaseMSSQL releases the session lock on the named resource.
+// It runs even if ctx is done, so a cancelled migration doesn't leave the lock held.
+func releaseMSSQL(ctx context.Context, conn *sql.Conn, name string) error {
+	ctx, cancel := releaseContext(ctx)
+	defer cancel()
+
+	var code int
+	if err := conn.QueryRowContext(ctx, "DECLARE @code INT; EXEC @code = sp_releaseapplock @Resource = @resource, @LockOwner = 'Session'; SELECT @code", sql.Named("resource", name)).Scan(&code); err != nil {
+		return err
+	}
+
+	if code < 0 {
+		return fmt.Errorf("mssql lock %s: not released, sp_releaseapplock returned %d", name, code)
+	}
+
+	return nil
+}
@@ -0,0 +1,173 @@
+package flit_test
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+
+	"github.com/180-studios/flit"
+	"github.com/google/go-cmp/cmp"
+)
+
+// recordingConnector connects to a fake database that records the statements it's sent.
+// Queries return no rows, except SQL Server's application lock procedures,
+// which return 0 as when the lock is granted or released.
+type recordingConnector struct {
+	mu      sync.Mutex
+	queries []string
+}
+
+func (c *recordingConnector) Connect(context.Context) (driver.Conn, error) {
+	return &recordingConn{c}, nil
+}
+
+func (c *recordingConnector) Driver() driver.Driver {
+	return c
+}
+
+func (c *recordingConnector) Open(string) (driver.Conn, error) {
+	return &recordingConn{c}, nil
+}
+
+func (c *recordingConnector) record(query string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.queries = append(c.queries, query)
+}
+
+type recordingConn struct {
+	c *recordingConnector
+}
+
+func (c *recordingConn) Prepare(query string) (driver.Stmt, error) {
+	return &recordingStmt{c, query}, nil
+}
+
+func (c *recordingConn) Close() error {
+	return nil
+}
+
+func (c *recordingConn) Begin() (driver.Tx, error) {
+	return recordingTx{}, nil
+}
+
+func (c *recordingConn) CheckNamedValue(*driver.NamedValue) error {
+	return nil
+}
+
+func (c *recordingConn) ExecContext(_ context.Context, query string, _ []driver.NamedValue) (driver.Result, error) {
+	c.c.record(query)
+	return driver.RowsAffected(1), nil
+}
+
+func (c *recordingConn) QueryContext(_ context.Context, query string, _ []driver.NamedValue) (driver.Rows, error) {
+	c.c.record(query)
+	if strings.Contains(query, "sp_getapplock") || strings.Contains(query, "sp_releaseapplock") {
+		return &recordingRows{values: [][]driver.Value{{int64(0)}}}, nil
+	}
+
+	return &recordingRows{}, nil
+}
+
+type recordingStmt struct {
+	conn  *recordingConn
+	query string
+}
+
+func (s *recordingStmt) Close() error {
+	return nil
+}
+
+func (s *recordingStmt) NumInput() int {
+	return -1
+}
+
+func (s *recordingStmt) Exec([]driver.Value) (driver.Result, error) {
+	return s.conn.ExecContext(context.Background(), s.query, nil)
+}
+
+func (s *recordingStmt) Query([]driver.Value) (driver.Rows, error) {
+	return s.conn.QueryContext(context.Background(), s.query, nil)
+}
+
+type recordingTx struct{}
+
+func (recordingTx) Commit() error {
+	return nil
+}
+
+func (recordingTx) Rollback() error {
+	return nil
+}
+
+type recordingRows struct {
+	values [][]driver.Value
+}
+
+func (r *recordingRows) Columns() []string {
+	return []string{"value"}
+}
+
+func (r *recordingRows) Close() error {
+	return nil
+}
+
+func (r *recordingRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
+
+func TestGuardMSSQL(t *testing.T) {
+	connector := new(recordingConnector)
+	db := sql.OpenDB(connector)
+	defer db.Close()
+
+	fsys := fstest.MapFS{"001-first.sql": {Data: []byte("CREATE TABLE data (id INT);")}}
+	m := flit.New(db, fsys, flit.WithDialect(flit.DialectMSSQL), flit.WithGuard(flit.GuardMSSQL))
+	applied, err := m.Migrate(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := cmp.Diff([]string{"001-first.sql"}, applied); diff != "" {
+		t.Errorf("applied mismatch (-want +got):\n%s", diff)
+	}
+
+	queries := connector.queries
+	if len(queries) == 0 || !strings.Contains(queries[0], "sp_getapplock") {
+		t.Errorf("expected the lock to be acquired first, got %q", queries)
+	}
+
+	if last := queries[len(queries)-1]; !strings.Contains(last, "sp_releaseapplock") {
+		t.Errorf("expected the lock to be released last, got %q", last)
+	}
+
+	for _, want := range []string{
+		"IF OBJECT_ID(@p1, N'U') IS NULL CREATE TABLE [flits] (sum CHAR(64) PRIMARY KEY, name VARCHAR(255), checksum CHAR(64), applied_at DATETIME2 NULL DEFAULT CURRENT_TIMESTAMP, dirty BIT NOT NULL DEFAULT 0, namespace VARCHAR(255) NOT NULL DEFAULT '', metadata NVARCHAR(MAX))",
+		"SELECT name FROM [flits] WHERE dirty = 1 AND namespace = @p1 ORDER BY name",
+		"UPDATE [flits] SET dirty = 0, applied_at = CURRENT_TIMESTAMP WHERE sum = @p1",
+	} {
+		if !strings.Contains(strings.Join(queries, "\n"), want) {
+			t.Errorf("expected statement %q, got %q", want, queries)
+		}
+	}
+
+	// none of these are valid T-SQL
+	for _, q := range queries {
+		for _, bad := range []string{"IF NOT EXISTS", "`", "BOOLEAN", "TRUE", "FALSE", "?"} {
+			if strings.Contains(q, bad) {
+				t.Errorf("statement %q contains %q", q, bad)
+			}
+		}
+	}
+}
@@ -4,21 +4,113 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"fmt"
+	"time"
+	"unicode/utf8"
 )
 
+// mysqlLockNameLength is the maximum length of a MySQL lock name.
+const mysqlLockNameLength = 64
+
 // GuardMySQL manages migration concurrency with MySQL's GET_LOCK and RELEASE_LOCK functions.
 // It gets a lock named "flit" before calling f and releases it after f returns.
 // GuardMySQL blocks until the lock is acquired or ctx is done.
 // Use this guard function by passing a [WithGuard] option to [New].
-func GuardMySQL(ctx context.Context, conn *sql.Conn, f func(context.Context, *sql.Conn) error) (err error) {
-	if _, err := conn.ExecContext(ctx, "SELECT GET_LOCK('flit', -1)"); err != nil {
+func GuardMySQL(ctx context.Context, conn *sql.Conn, f func(context.Context, *sql.Conn) error) error {
+	return guardMySQL(ctx, conn, "flit", -1, f)
+}
+
+// GuardMySQLNamed returns a guard function like [GuardMySQL] that uses the given lock name instead of "flit".
+// Independent sets of migrations on the same MySQL server can use different names
+// so they don't wait for each other.
+// The name must not be empty or longer than 64 characters;
+// if it is, the guard function returns an error without calling f.
+func GuardMySQLNamed(name string) GuardFunc {
+	return func(ctx context.Context, conn *sql.Conn, f func(context.Context, *sql.Conn) error) error {
+		if n := utf8.RuneCountInString(name); n == 0 || n > mysqlLockNameLength {
+			return fmt.Errorf("mysql lock name %q must have 1 to %d characters", name, mysqlLockNameLength)
+		}
+
+		return guardMySQL(ctx, conn, name, -1, f)
+	}
+}
+
+// GuardMySQLTimeout returns a guard function like [GuardMySQL] that waits at most d for the lock.
+// If the lock isn't acquired in time, the guard function returns an error wrapping [ErrLockBusy] without calling f,
+// so a deployment fails instead of waiting forever for a lock held by a hung process.
+// MySQL measures the timeout in whole seconds, so d is rounded up to a second.
+// The guard function still returns early if ctx is done first.
+// A zero d doesn't wait, like [GuardMySQLTryLock].
+// MySQL waits forever for a negative timeout, so if d is negative
+// the guard function returns an error without calling f; use [GuardMySQL] to wait forever.
+func GuardMySQLTimeout(d time.Duration) GuardFunc {
+	seconds := int64((d + time.Second - 1) / time.Second)
+	return func(ctx context.Context, conn *sql.Conn, f func(context.Context, *sql.Conn) error) error {
+		if d < 0 {
+			return fmt.Errorf("mysql lock timeout %s must not be negative", d)
+		}
+
+		return guardMySQL(ctx, conn, "flit", seconds, f)
+	}
+}
+
+// GuardMySQLTryLock returns a guard function like [GuardMySQL] that doesn't wait for the lock.
+// If another process holds the lock, the guard function returns an error wrapping [ErrLockBusy]
+// without calling f, so the caller can skip migrating and let the other process do it.
+func GuardMySQLTryLock() GuardFunc {
+	return func(ctx context.Context, conn *sql.Conn, f func(context.Context, *sql.Conn) error) error {
+		return guardMySQL(ctx, conn, "flit", 0, f)
+	}
+}
+
+// guardMySQL calls f while holding the named MySQL lock.
+// It waits for the lock for the given number of seconds, or forever if timeout is negative.
+// The name is passed as an argument, so it doesn't need to be escaped.
+//
+// GET_LOCK returns 1 if the lock was acquired, 0 if it timed out, and NULL if an error occurred,
+// such as the session being killed. RELEASE_LOCK returns 1 if the lock was released,
+// 0 if it's held by another session, and NULL if it doesn't exist.
+// Any result other than 1 is an error, so f never runs without the lock.
+func guardMySQL(ctx context.Context, conn *sql.Conn, name string, timeout int64, f func(context.Context, *sql.Conn) error) (err error) {
+	if err := checkDriver(conn, "mysql"); err != nil {
+		return err
+	}
+
+	var acquired sql.NullInt64
+	if err := conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, ?)", name, timeout).Scan(&acquired); err != nil {
 		return err
 	}
 
+	switch {
+	case !acquired.Valid:
+		return fmt.Errorf("mysql lock %s: not acquired", name)
+	case acquired.Int64 == 0 && timeout == 0:
+		return fmt.Errorf("mysql lock %s: %w", name, ErrLockBusy)
+	case acquired.Int64 == 0:
+		return fmt.Errorf("mysql lock %s: timed out after %ds: %w", name, timeout, ErrLockBusy)
+	case acquired.Int64 != 1:
+		return fmt.Errorf("mysql lock %s: unexpected result %d", name, acquired.Int64)
+	}
+
 	defer func() {
-		_, re := conn.ExecContext(ctx, "SELECT RELEASE_LOCK('flit')")
-		err = errors.Join(err, re)
+		ctx, cancel := releaseContext(ctx)
+		defer cancel()
+		err = errors.Join(err, releaseMySQL(ctx, conn, name))
 	}()
 
 	return f(ctx, conn)
 }
+
+// releaseMySQL releases the named MySQL lock.
+func releaseMySQL(ctx context.Context, conn *sql.Conn, name string) error {
+	var released sql.NullInt64
+	if err := conn.QueryRowContext(ctx, "SELECT RELEASE_LOCK(?)", name).Scan(&released); err != nil {
+		return err
+	}
+
+	if !released.Valid || released.Int64 != 1 {
+		return fmt.Errorf("mysql lock %s: not held when released", name)
+	}
+
+	return nil
+}
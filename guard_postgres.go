@@ -0,0 +1,54 @@
+package flit
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"hash/fnv"
+)
+
+// postgresLockKey is the advisory lock key used by [GuardPostgres].
+// It is derived from the FNV-1a hash of "flit" so every process agrees on it.
+var postgresLockKey = func() int64 {
+	h := fnv.New64a()
+	h.Write([]byte("flit"))
+	return int64(h.Sum64())
+}()
+
+// GuardPostgres manages migration concurrency with PostgreSQL's session-level advisory locks.
+// It calls pg_advisory_lock before calling f and pg_advisory_unlock after f returns.
+// The lock key is derived from a hash of "flit", so all processes use the same key.
+// GuardPostgres blocks until the lock is acquired or ctx is done.
+// Use this guard function by passing a [WithGuard] option to [New].
+func GuardPostgres(ctx context.Context, conn *sql.Conn, f func(context.Context, *sql.Conn) error) (err error) {
+	if err := checkDriver(conn, "postgres"); err != nil {
+		return err
+	}
+
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", postgresLockKey); err != nil {
+		return err
+	}
+
+	defer func() {
+		ctx, cancel := releaseContext(ctx)
+		defer cancel()
+		err = errors.Join(err, releasePostgres(ctx, conn))
+	}()
+
+	return f(ctx, conn)
+}
+
+// releasePostgres releases the advisory lock.
+// pg_advisory_unlock returns false, rather than an error, if the session doesn't hold the lock.
+func releasePostgres(ctx context.Context, conn *sql.Conn) error {
+	var released bool
+	if err := conn.QueryRowContext(ctx, "SELECT pg_advisory_unlock($1)", postgresLockKey).Scan(&released); err != nil {
+		return err
+	}
+
+	if !released {
+		return errors.New("postgres advisory lock: not held when released")
+	}
+
+	return nil
+}
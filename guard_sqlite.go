@@ -0,0 +1,42 @@
+package flit
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+)
+
+// GuardSQLite manages migration concurrency with SQLite's database write lock.
+// It begins an immediate transaction before calling f,
+// commits it if f succeeds, and rolls it back if f fails.
+// Because all of f runs in the transaction, a failed migration leaves the database unchanged.
+// GuardSQLite blocks until the write lock is acquired or the connection's busy timeout expires,
+// so configure a busy timeout when opening the database, such as with the _busy_timeout DSN parameter.
+//
+// GuardSQLite serializes migrations run by separate processes against the same database file.
+// In-memory databases can't be shared by processes, so they only need the default guard.
+// GuardSQLite can't be combined with [WithTransactions], because SQLite doesn't support nested transactions.
+// Use this guard function by passing a [WithGuard] option to [New].
+func GuardSQLite(ctx context.Context, conn *sql.Conn, f func(context.Context, *sql.Conn) error) (err error) {
+	if err := checkDriver(conn, "sqlite"); err != nil {
+		return err
+	}
+
+	if _, err := conn.ExecContext(ctx, "BEGIN IMMEDIATE"); err != nil {
+		return err
+	}
+
+	defer func() {
+		ctx, cancel := releaseContext(ctx)
+		defer cancel()
+		if err != nil {
+			_, re := conn.ExecContext(ctx, "ROLLBACK")
+			err = errors.Join(err, re)
+			return
+		}
+
+		_, err = conn.ExecContext(ctx, "COMMIT")
+	}()
+
+	return f(ctx, conn)
+}
@@ -0,0 +1,165 @@
+package flit_test
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/180-studios/flit"
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+func TestGuardSQLite(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		tableExists bool
+	}{
+		{"table doesn't exist", false},
+		{"table exists", true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dsn := "file:" + filepath.Join(t.TempDir(), "test.db") + "?_busy_timeout=5000"
+			if tc.tableExists {
+				db, err := sql.Open("sqlite3", dsn)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				_, err = flit.New(db, fstest.MapFS{}).Status(t.Context())
+				if err := errors.Join(err, db.Close()); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			var (
+				wg      sync.WaitGroup
+				mu      sync.Mutex
+				applied []string
+				start   = make(chan struct{})
+			)
+
+			// each racer has its own database and default mutex, as separate processes would
+			for range 4 {
+				db, err := sql.Open("sqlite3", dsn)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				t.Cleanup(func() {
+					if err := db.Close(); err != nil {
+						t.Error(err)
+					}
+				})
+
+				// widen the window between reading the applied migrations and applying them
+				m := flit.New(db, os.DirFS("testdata/example"), flit.WithGuard(flit.GuardSQLite), flit.WithProgress(func(int, int, string) {
+					time.Sleep(10 * time.Millisecond)
+				}))
+
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					<-start
+					a, err := m.Migrate(t.Context())
+					if err != nil {
+						t.Error(err)
+					}
+
+					mu.Lock()
+					defer mu.Unlock()
+					applied = append(applied, a...)
+				}()
+			}
+
+			close(start)
+			wg.Wait()
+
+			slices.Sort(applied)
+			if diff := cmp.Diff([]string{"001-first.sql", "002-second.sql"}, applied); diff != "" {
+				t.Errorf("applied migrations differ (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+// ctxDriver wraps the SQLite driver so that, like the MySQL and PostgreSQL drivers,
+// its connections don't send statements on a done context.
+type ctxDriver struct {
+	sqlite3.SQLiteDriver
+}
+
+func (d *ctxDriver) Open(name string) (driver.Conn, error) {
+	c, err := d.SQLiteDriver.Open(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ctxConn{c.(*sqlite3.SQLiteConn)}, nil
+}
+
+type ctxConn struct {
+	*sqlite3.SQLiteConn
+}
+
+func (c *ctxConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	return c.SQLiteConn.ExecContext(ctx, query, args)
+}
+
+func (c *ctxConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	return c.SQLiteConn.QueryContext(ctx, query, args)
+}
+
+func init() {
+	sql.Register("sqlite3-ctx", new(ctxDriver))
+}
+
+func TestGuardSQLiteCancelled(t *testing.T) {
+	db, err := sql.Open("sqlite3-ctx", "file:"+filepath.Join(t.TempDir(), "test.db")+"?_busy_timeout=100")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		if err := db.Close(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	// the next migration reuses the session that held the lock
+	db.SetMaxOpenConns(1)
+
+	ctx, cancel := context.WithCancel(t.Context())
+	m := flit.New(db, fstest.MapFS{}, flit.WithGuard(flit.GuardSQLite))
+	m.Register("001-cancel", func(ctx context.Context, _ *sql.Conn) error {
+		cancel()
+		return ctx.Err()
+	})
+
+	if _, err := m.Migrate(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected the migration to be cancelled, got %v", err)
+	}
+
+	// the lock was released, so the guard can be acquired again
+	m = flit.New(db, fstest.MapFS{"001-first.sql": {Data: []byte("CREATE TABLE data (id INTEGER);")}}, flit.WithGuard(flit.GuardSQLite))
+	if _, err := m.Migrate(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+}
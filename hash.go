@@ -0,0 +1,114 @@
+package flit
+
+import (
+	"context"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"path"
+	"strings"
+)
+
+// WithHasher configures Flit to compute the sums identifying migrations,
+// and the checksums of their content, with the hash functions returned by newHash.
+// The default is [crypto/sha256.New].
+//
+// Sums are stored hex-encoded, so the "flits" table, or the table configured by [WithTable],
+// is created with columns sized to twice the hash's [hash.Hash.Size].
+// Changing the hasher of an existing table changes every sum,
+// so Flit returns an error if the table contains sums of a different length.
+func WithHasher(newHash func() hash.Hash) ConfigOption {
+	return func(c *Migrator) {
+		c.hasher = newHash
+	}
+}
+
+// hash returns the hex-encoded hash of data computed with the configured hasher.
+func (m *Migrator) hash(data []byte) string {
+	h := m.hasher()
+	h.Write(data)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// hashContent computes the checksum of the named migration file's content, as read by read,
+// by copying the file through the hasher, so the content isn't held in memory.
+// Templates can only be rendered from the whole file, so if template data is configured,
+// the checksum of the content returned by read is returned instead.
+func (m *Migrator) hashContent(name string, read func() (*content, error)) (string, error) {
+	if m.templateData != nil {
+		c, err := read()
+		if err != nil {
+			return "", err
+		}
+
+		return c.Checksum, nil
+	}
+
+	f, err := m.source.Open(name)
+	if err != nil {
+		return "", err
+	}
+
+	defer f.Close()
+
+	h := m.hasher()
+	if err := m.expandTo(h, []string{name}, f); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// sumLength returns the length of the hex-encoded hashes computed with the configured hasher.
+func (m *Migrator) sumLength() int {
+	return hex.EncodedLen(m.hasher().Size())
+}
+
+// sum returns the sum identifying the named migration.
+// It is computed from the file name, without the directory,
+// so a migration's identity doesn't depend on how the file system or globs are arranged.
+// The sums of migrations in a namespace are computed from the namespace too.
+func (m *Migrator) sum(name string) string {
+	if m.namespace != "" {
+		return m.hash([]byte(m.namespace + "/" + path.Base(name)))
+	}
+
+	return m.hash([]byte(path.Base(name)))
+}
+
+// SumFor returns the sum that identifies the named migration in the "flits" table,
+// or the table configured by [WithTable], so tooling can cross-check a name against its row.
+// Like [Migration.Sum], it is computed from the file name without its directory,
+// with the hasher configured by [WithHasher] and the namespace configured by [WithNamespace].
+// The migration doesn't need to exist.
+func (m *Migrator) SumFor(name string) string {
+	return m.sum(name)
+}
+
+// legacySum returns the sum older versions of Flit computed for the named migration, from its full path.
+func (m *Migrator) legacySum(name string) string {
+	return m.hash([]byte(name))
+}
+
+// checkSumLength returns an error if the configured table contains sums
+// that weren't computed with the configured hasher.
+func (m *Migrator) checkSumLength(ctx context.Context, conn *sql.Conn) error {
+	var stored string
+	err := conn.QueryRowContext(ctx, "SELECT sum FROM "+m.quotedTable()).Scan(&stored)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	// CHAR columns are padded with spaces by some databases
+	if n := len(strings.TrimRight(stored, " ")); n != m.sumLength() {
+		return fmt.Errorf("%s table contains %d-character sums, but the hasher computes %d-character sums: the table was created with a different hasher", m.table, n, m.sumLength())
+	}
+
+	return nil
+}
@@ -0,0 +1,34 @@
+package flit
+
+import "context"
+
+// WithBeforeEach configures Flit to call f immediately before applying each migration.
+// If f returns an error, the migration isn't applied and [Migrator.Migrate] returns the error
+// wrapped with the migration's name.
+func WithBeforeEach(f func(ctx context.Context, name string) error) ConfigOption {
+	return func(c *Migrator) {
+		c.beforeEach = f
+	}
+}
+
+// WithAfterEach configures Flit to call f immediately after applying each migration,
+// whether or not it was applied successfully.
+// The err argument is the error that applying the migration produced, or nil.
+// If f returns an error other than err, [Migrator.Migrate] stops and returns it
+// wrapped with the migration's name, joined with err.
+func WithAfterEach(f func(ctx context.Context, name string, err error) error) ConfigOption {
+	return func(c *Migrator) {
+		c.afterEach = f
+	}
+}
+
+// WithProgress configures Flit to call f before applying each migration,
+// with the number of migrations [Migrator.Migrate] has attempted so far,
+// the total number it is about to apply, and the name of the migration being applied.
+// It is called while the guard is held, in the order the migrations are applied,
+// so it can be used to render a progress bar or log a heartbeat.
+func WithProgress(f func(done, total int, current string)) ConfigOption {
+	return func(c *Migrator) {
+		c.progress = f
+	}
+}
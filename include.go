@@ -0,0 +1,111 @@
+package flit
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"path"
+	"slices"
+	"strings"
+)
+
+// include is the directive that inlines another file in a migration.
+// The rest of the line is the file's path in the migration source.
+const include = "-- flit:include"
+
+// expand replaces each line of the named migration that is an include directive
+// with the content of the file it names, expanding included files recursively.
+// The paths are resolved from the root of the migration source, not the including file's directory.
+// It returns an error if a file includes itself, directly or indirectly.
+func (m *Migrator) expand(name string, data []byte) ([]byte, error) {
+	if !bytes.Contains(data, []byte(include)) {
+		return data, nil
+	}
+
+	var b bytes.Buffer
+	if err := m.expandTo(&b, []string{name}, bytes.NewReader(data)); err != nil {
+		return nil, err
+	}
+
+	return b.Bytes(), nil
+}
+
+// expandTo copies the last file in stack, read from r, to w, expanding its include directives.
+// The stack lists the files being expanded, outermost first.
+// The file is copied a line at a time, so it isn't held in memory.
+func (m *Migrator) expandTo(w io.Writer, stack []string, r io.Reader) error {
+	br := bufio.NewReader(r)
+	midLine := false // whether the last read ended partway through a long line
+	for {
+		line, err := br.ReadSlice('\n')
+		if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+			return err
+		}
+
+		// only a short, whole line can be a directive
+		var (
+			target string
+			ok     bool
+		)
+
+		if !midLine && err != bufio.ErrBufferFull {
+			target, ok = strings.CutPrefix(strings.TrimSpace(string(line)), include+" ")
+		}
+
+		midLine = err == bufio.ErrBufferFull
+		if ok {
+			if err := m.include(w, stack, path.Clean(strings.TrimSpace(target))); err != nil {
+				return err
+			}
+		} else if _, err := w.Write(line); err != nil {
+			return err
+		}
+
+		if err == io.EOF {
+			return nil
+		}
+	}
+}
+
+// include copies the target file, included by the last file in stack, to w, expanding its include directives.
+// A newline is added if the file doesn't end with one, so the including file's next line starts on its own line.
+func (m *Migrator) include(w io.Writer, stack []string, target string) error {
+	name := stack[len(stack)-1]
+	if slices.Contains(stack, target) {
+		return fmt.Errorf("include %s in %s: cycle %s -> %s", target, name, strings.Join(stack, " -> "), target)
+	}
+
+	f, err := m.source.Open(target)
+	if err != nil {
+		return fmt.Errorf("include %s in %s: %w", target, name, err)
+	}
+
+	defer f.Close()
+
+	lw := &lastByteWriter{w: w}
+	if err := m.expandTo(lw, append(stack, target), f); err != nil {
+		return err
+	}
+
+	if lw.written && lw.last != '\n' {
+		_, err = io.WriteString(w, "\n")
+	}
+
+	return err
+}
+
+// A lastByteWriter writes to w and remembers the last byte written.
+type lastByteWriter struct {
+	w       io.Writer
+	last    byte
+	written bool
+}
+
+func (lw *lastByteWriter) Write(p []byte) (int, error) {
+	if len(p) > 0 {
+		lw.last, lw.written = p[len(p)-1], true
+	}
+
+	return lw.w.Write(p)
+}
@@ -0,0 +1,179 @@
+package flit
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// Baseline records every migration up to and including upTo as applied, without executing them.
+// It is used to adopt Flit for a database whose schema already matches those migrations.
+// Migrations that are already recorded are skipped,
+// and dirty migrations, which failed partway through, are marked as applied,
+// so a failed migration that was completed by hand can be recorded with Baseline.
+// Baseline returns an error if upTo isn't the name of a migration.
+//
+// Baseline is guarded the same way as [Migrator.Migrate].
+func (m *Migrator) Baseline(ctx context.Context, upTo string) error {
+	migrations, err := m.loadMigrations()
+	if err != nil {
+		return err
+	}
+
+	i := slices.IndexFunc(migrations, func(mig migration) bool {
+		return mig.Name == upTo
+	})
+
+	if i < 0 {
+		return fmt.Errorf("baseline: unknown migration %s", upTo)
+	}
+
+	return m.guarded(ctx, migrations, func(ctx context.Context, conn *sql.Conn) (err error) {
+		records, err := m.getRecordsBySum(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		rec, err := m.prepareRecorder(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		defer func() {
+			err = errors.Join(err, rec.Close())
+		}()
+
+		for _, mig := range migrations[:i+1] {
+			if err := markApplied(ctx, rec, records, mig); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// markApplied records a migration as applied, given the records of the configured table by sum.
+// A dirty migration is marked clean, and a completed migration is left as it is.
+func markApplied(ctx context.Context, rec *recorder, records map[string]record, mig migration) error {
+	r, ok := records[mig.Sum]
+	switch {
+	case ok && r.Dirty:
+		return rec.clean(ctx, mig)
+	case ok:
+		return nil
+	default:
+		return rec.record(ctx, nil, mig, false)
+	}
+}
+
+// MarkApplied records the named migrations as applied, without executing them.
+// Unlike [Migrator.Baseline], it records exactly the named migrations,
+// such as ones that were applied by a different tool.
+// MarkApplied returns an error naming each migration that doesn't exist or is already applied,
+// before recording any of them. Dirty migrations, which failed partway through, are marked as applied.
+//
+// MarkApplied is guarded the same way as [Migrator.Migrate].
+func (m *Migrator) MarkApplied(ctx context.Context, names ...string) error {
+	migrations, err := m.loadMigrations()
+	if err != nil {
+		return err
+	}
+
+	byName := make(map[string]bool, len(names))
+	for _, name := range names {
+		byName[name] = true
+	}
+
+	var (
+		marked  []migration
+		unknown []error
+	)
+
+	for _, mig := range migrations {
+		if byName[mig.Name] {
+			marked = append(marked, mig)
+			delete(byName, mig.Name)
+		}
+	}
+
+	for _, name := range names {
+		if byName[name] {
+			unknown = append(unknown, fmt.Errorf("mark %s: unknown migration", name))
+			delete(byName, name)
+		}
+	}
+
+	if err := errors.Join(unknown...); err != nil {
+		return err
+	}
+
+	return m.guarded(ctx, migrations, func(ctx context.Context, conn *sql.Conn) (err error) {
+		records, err := m.getRecordsBySum(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		var errs []error
+		for _, mig := range marked {
+			if r, ok := records[mig.Sum]; ok && !r.Dirty {
+				errs = append(errs, fmt.Errorf("mark %s: already applied", mig.Name))
+			}
+		}
+
+		if err := errors.Join(errs...); err != nil {
+			return err
+		}
+
+		rec, err := m.prepareRecorder(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		defer func() {
+			err = errors.Join(err, rec.Close())
+		}()
+
+		for _, mig := range marked {
+			if err := markApplied(ctx, rec, records, mig); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// Unmark deletes the record of the named migration without executing its down script,
+// so it is pending again. It is the counterpart of [Migrator.MarkApplied],
+// for cleaning up migrations that were recorded by mistake.
+// The migration doesn't need to exist in the file system.
+// Unmark returns an error if the migration isn't recorded.
+//
+// Unmark is guarded the same way as [Migrator.Migrate].
+func (m *Migrator) Unmark(ctx context.Context, name string) error {
+	migrations, err := m.loadMigrations()
+	if err != nil {
+		return err
+	}
+
+	return m.guarded(ctx, migrations, func(ctx context.Context, conn *sql.Conn) error {
+		res, err := conn.ExecContext(ctx, "DELETE FROM "+m.quotedTable()+" WHERE sum = "+m.dialect.placeholder(1)+" AND "+m.inNamespace(2), m.sum(name), m.namespace)
+		if err != nil {
+			return fmt.Errorf("unmark %s: %w", name, err)
+		}
+
+		n, err := res.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("unmark %s: %w", name, err)
+		}
+
+		if n == 0 {
+			return fmt.Errorf("unmark %s: not recorded", name)
+		}
+
+		return nil
+	})
+}
@@ -4,44 +4,217 @@ import (
 	"context"
 	"crypto/sha256"
 	"database/sql"
-	"encoding/hex"
+	"errors"
 	"fmt"
+	"hash"
 	"io/fs"
+	"log/slog"
+	"maps"
+	"path"
+	"reflect"
+	"regexp"
+	"runtime"
 	"slices"
 	"strings"
 	"sync"
+	"time"
+	"unicode"
+	"weak"
 )
 
 // A Migrator holds the configuration required to migrate a database.
 // Call [New] to create a new Migrator.
 type Migrator struct {
-	db    *sql.DB
-	fs    fs.FS
-	glob  string
-	guard GuardFunc
+	db                DB
+	source            Source
+	globs             []string
+	guard             GuardFunc
+	verifyChecksum    bool
+	table             string
+	transactions      bool
+	split             func(string) []string
+	dialect           Dialect
+	beforeEach        func(context.Context, string) error
+	progress          func(done, total int, current string)
+	observer          func(Event)
+	hasher            func() hash.Hash
+	namespace         string
+	createTable       bool
+	fsys              fs.FS // set by WithFS
+	additionalFS      []fs.FS
+	metadata          sql.NullString // JSON, set by WithMetadata
+	afterEach         func(context.Context, string, error) error
+	logger            *slog.Logger
+	recursive         bool
+	excludes          []string
+	strictOrphans     bool
+	strictOrdering    bool
+	repeatable        string // the prefix of repeatable migrations
+	templateData      map[string]any
+	continueOnError   bool
+	skipEmpty         bool
+	namePattern       *regexp.Regexp
+	uniqueVersions    bool
+	noGaps            bool
+	timeout           time.Duration
+	sort              func(a, b string) int
+	singleTransaction bool
+	retryAttempts     int
+	retryBackoff      time.Duration
+	retryable         func(error) bool
+	funcs             map[string]MigrationFunc
+	err               error // a configuration error returned by every operation
 }
 
 type migration struct {
-	Sum  string // hex(sha256(Name))
+	Sum  string // hex(hash(path.Base(Name))), with the configured hasher
 	Name string
-	SQL  string
+	Func MigrationFunc // non-nil for migrations registered with [Migrator.Register]
+
+	Repeatable bool // re-applied whenever its checksum changes
+
+	// read reads the migration's content the first time it is called, and returns the same content after that.
+	// hash computes the checksum of its content in the same way, without holding the content in memory.
+	// Both are nil for migrations registered with [Migrator.Register].
+	read func() (*content, error)
+	hash func() (string, error)
+}
+
+// content is the content of a migration file.
+// It is only read when it is needed, such as when the migration is pending,
+// so the content of applied migrations isn't held in memory.
+type content struct {
+	Checksum      string // hex(hash(SQL))
+	SQL           string
+	Down          *string // nil if there is no down script
+	NoTransaction bool    // run outside a transaction even if transactions are enabled, by directive or because it begins its own
 }
 
+// content returns the migration's content, reading it if it hasn't been read.
+// Migrations registered with [Migrator.Register] have empty content.
+func (mig migration) content() (*content, error) {
+	if mig.read == nil {
+		return new(content), nil
+	}
+
+	return mig.read()
+}
+
+// checksum returns the checksum of the migration's content.
+// Migrations registered with [Migrator.Register] have an empty checksum.
+func (mig migration) checksum() (string, error) {
+	if mig.hash == nil {
+		return "", nil
+	}
+
+	return mig.hash()
+}
+
+// ErrChecksumMismatch is returned by [Migrator.Migrate] when checksum verification is enabled
+// and the content of an applied migration has changed since it was applied.
+var ErrChecksumMismatch = errors.New("checksum mismatch")
+
+// ErrOrphanedMigration is returned by [Migrator.Migrate] when strict orphan detection is enabled
+// and a migration recorded as applied no longer exists in the file system.
+var ErrOrphanedMigration = errors.New("orphaned migration")
+
+// ErrOutOfOrder is returned by [Migrator.Migrate] when strict ordering is enabled
+// and a pending migration is ordered before an applied migration.
+var ErrOutOfOrder = errors.New("migration out of order")
+
+// ErrDirty is returned by [Migrator.Migrate] when a previous migration failed partway through,
+// leaving the database in an unknown state.
+var ErrDirty = errors.New("database is dirty")
+
+// ErrPending is returned by [Migrator.Verify] when a migration hasn't been applied.
+var ErrPending = errors.New("pending migration")
+
+// ErrLockBusy is returned by guard functions that don't wait indefinitely, such as [GuardMySQLTryLock],
+// when another process holds the lock.
+var ErrLockBusy = errors.New("lock is busy")
+
+// identifierPattern matches the SQL identifiers Flit accepts in configuration.
+var identifierPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// noTransaction is the directive that, in the comments at the start of a migration,
+// makes it run outside a transaction when [WithTransactions] is used.
+const noTransaction = "-- flit:no-transaction"
+
+// DefaultNamePattern is a conventional pattern for migration file names,
+// a number followed by a dash or underscore and a description, such as "001-first.sql".
+// Pass it to [WithNamePattern] to enforce it:
+//
+//	flit.WithNamePattern(regexp.MustCompile(flit.DefaultNamePattern))
+const DefaultNamePattern = `^\d+[-_].+\.sql$`
+
+// downSuffix is the file name suffix of down scripts.
+const downSuffix = ".down.sql"
+
 // A ConfigOption can be passed to [New] to change the configuration.
-// The [WithGlob] option configures the pattern used to load migration files.
+// The [WithGlob] and [WithGlobs] options configure the patterns used to load migration files.
 // The [WithGuard] option configures the concurrency guard function.
+// The [WithChecksumVerification] option enables detection of edited migrations.
+// The [WithDialect] option configures the SQL syntax used by the database.
+// The [WithBeforeEach] and [WithAfterEach] options configure hooks called around each migration.
 type ConfigOption func(*Migrator)
 
+// A DB is a pool of database connections, such as [*sql.DB].
+// Flit acquires a connection from it for each operation, and releases it when the operation is done.
+// Pass a type wrapping a *sql.DB to [New] to instrument the connections Flit uses.
+type DB interface {
+	Conn(ctx context.Context) (*sql.Conn, error)
+}
+
 // GuardFunc is called by [Migrator.Migrate] to manage concurrency.
 type GuardFunc func(context.Context, *sql.Conn, func(context.Context, *sql.Conn) error) error
 
 // New creates a new migrator for the given database, file system, and options.
-func New(db *sql.DB, fsys fs.FS, options ...ConfigOption) *Migrator {
+// Migration files are loaded from fsys; see [NewWithSource] to load them from elsewhere.
+//
+// Migrations are named by their paths in fsys but identified by their file names,
+// so the same files loaded through a different directory layout aren't applied again,
+// and no two migrations may have the same file name.
+// Files embedded with a directive such as //go:embed migrations/*.sql keep their directory in their names;
+// pass the result of [fs.Sub] for that directory to name them as [os.DirFS] would.
+func New(db DB, fsys fs.FS, options ...ConfigOption) *Migrator {
+	m := newMigrator(db, options)
+	if m.fsys != nil {
+		fsys = m.fsys
+	}
+
+	if (fsys == nil || slices.Contains(m.additionalFS, nil)) && m.err == nil {
+		m.err = errors.New("no migration file system: pass one to New or configure one with WithFS")
+	}
+
+	m.source = &fsSource{fs: fsys, globs: m.globs, recursive: m.recursive}
+	if len(m.additionalFS) > 0 {
+		merged := &mergedSource{sources: []Source{m.source}}
+		for _, fsys := range m.additionalFS {
+			merged.sources = append(merged.sources, &fsSource{fs: fsys, globs: m.globs, recursive: m.recursive})
+		}
+
+		m.source = merged
+	}
+
+	return m
+}
+
+// newMigrator creates a new migrator with the default configuration and the given options.
+// The caller must set its source.
+func newMigrator(db DB, options []ConfigOption) *Migrator {
 	m := &Migrator{
-		db:    db,
-		fs:    fsys,
-		guard: new(mutexGuard).Guard,
-		glob:  "*.sql",
+		db:            db,
+		guard:         dbMutex(db).Guard,
+		globs:         []string{"*.sql"},
+		table:         "flits",
+		split:         splitStatements,
+		sort:          strings.Compare,
+		dialect:       detectDialect(db),
+		retryAttempts: 1,
+		retryable:     isTransient,
+		hasher:        sha256.New,
+		createTable:   true,
+		logger:        slog.New(slog.DiscardHandler),
 	}
 
 	for _, o := range options {
@@ -51,137 +224,1096 @@ func New(db *sql.DB, fsys fs.FS, options ...ConfigOption) *Migrator {
 	return m
 }
 
+// Run creates a migrator with [New] and applies pending migrations with [Migrator.Migrate],
+// for programs that only need to migrate once.
+// It returns the names of the migrations that were applied.
+func Run(ctx context.Context, db DB, fsys fs.FS, options ...ConfigOption) ([]string, error) {
+	return New(db, fsys, options...).Migrate(ctx)
+}
+
 // Migrate applies pending migrations to the database.
 // It returns the names of the migrations that were applied.
 //
 // Migrations are loaded from .sql files in the root of the configured file system.
+// Files ending in ".down.sql" are down scripts used by [Migrator.Rollback], not migrations.
 // The migrations are ordered by name before being applied.
-// Each migration is executed as a single SQL statement.
-// After a migration is completed a checksum of its name is recorded in the "flits" table,
-// which is created automatically.
+// Each migration is split into statements which are executed in order.
+// By default a statement ends with a semicolon at the end of a line;
+// see [WithStatementSplitter] to change this.
+// After a migration is completed its name and a checksum of its file name are recorded in the "flits" table,
+// which is created automatically, along with the time it was applied.
+// The table name can be changed by passing a [WithTable] option to [New].
+// A table created by an older version of Flit is upgraded:
+// the columns it's missing are added, and the sums of migrations in subdirectories,
+// which older versions computed from their full path, are rewritten.
+//
+// Unless [WithTransactions] is used, each migration is recorded as dirty before it is executed,
+// and marked clean once it succeeds.
+// If a migration fails, Migrate refuses to run again, returning an error wrapping [ErrDirty],
+// until the database is fixed by hand and [Migrator.Repair] is called.
 //
-// Migrate is guarded by a mutex.
-// This guard can be replaced by passing a [WithGuard] option to [New].
+// Migrate is guarded by a mutex, which is shared by every migrator created with the same database,
+// so migrators created in the same process don't migrate concurrently.
+// The mutex doesn't span processes, so processes that may migrate the same database at once,
+// such as replicas of a service starting together, must replace it by passing a [WithGuard] option to [New].
+// The table is created, and the applied migrations are read, while the guard is held,
+// so processes racing on the first run never apply the same migration twice.
 // For example, [GuardMySQL] uses MySQL's GET_LOCK and RELEASE_LOCK functions.
+// [GuardPostgres] uses PostgreSQL's session-level advisory locks.
+// [GuardSQLite] uses SQLite's database write lock.
+// [GuardMSSQL] uses SQL Server's application locks.
+//
+// Errors caused by the recorded history rather than by a migration's SQL wrap
+// [ErrChecksumMismatch], [ErrOrphanedMigration], [ErrOutOfOrder], or [ErrDirty],
+// and can be distinguished with [errors.Is].
+// Migrate doesn't apply any migrations when it returns one of these errors.
+//
+// If ctx is cancelled, Migrate stops before the next migration,
+// returning the migrations applied so far and ctx.Err().
 func (m *Migrator) Migrate(ctx context.Context) (applied []string, err error) {
+	result, err := m.MigrateResult(ctx)
+	return result.names(), err
+}
+
+// MigrateConn applies pending migrations to the database, like [Migrator.Migrate],
+// but on the given connection instead of one acquired from the database passed to [New].
+// The guard is called with conn too, so session locks such as [GuardMySQL] and [GuardPostgres]
+// are held by the session that applies the migrations,
+// and session settings configured by the caller apply to the migrations.
+// MigrateConn doesn't close conn, and isn't retried by [WithRetry], which would reuse it.
+func (m *Migrator) MigrateConn(ctx context.Context, conn *sql.Conn) (applied []string, err error) {
+	migrations, err := m.loadMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := m.migrate(ctx, conn, migrations, "")
+	return result.names(), err
+}
+
+// An AppliedMigration describes a migration applied by [Migrator.MigrateResult].
+type AppliedMigration struct {
+	Name     string
+	Sum      string
+	Duration time.Duration // how long it took to apply the migration
+}
+
+// A Result describes what [Migrator.MigrateResult] did.
+type Result struct {
+	// Applied describes each migration that was applied, in the order they were applied.
+	Applied []AppliedMigration
+
+	// UpToDate is the number of migrations that had already been applied, and weren't applied again.
+	// Together with Applied, it distinguishes a database that is up to date from a missing migration directory.
+	UpToDate int
+}
+
+// names returns the names of the applied migrations.
+func (r Result) names() []string {
+	var names []string
+	for _, a := range r.Applied {
+		names = append(names, a.Name)
+	}
+
+	return names
+}
+
+// MigrateResult applies pending migrations to the database, like [Migrator.Migrate].
+// It returns a description of each migration that was applied, including how long it took,
+// and the number of migrations that were already up to date.
+func (m *Migrator) MigrateResult(ctx context.Context) (Result, error) {
+	migrations, err := m.loadMigrations()
+	if err != nil {
+		return Result{}, err
+	}
+
+	return m.migrate(ctx, nil, migrations, "")
+}
+
+// MigrateTo applies pending migrations to the database, like [Migrator.Migrate],
+// but only those ordered before the named target migration and the target itself.
+// It returns the names of the migrations that were applied.
+// If the target has already been applied, MigrateTo doesn't apply anything.
+// If the target isn't the name of a migration, MigrateTo returns an error.
+func (m *Migrator) MigrateTo(ctx context.Context, target string) ([]string, error) {
 	migrations, err := m.loadMigrations()
 	if err != nil {
+		return nil, err
+	}
+
+	if !slices.ContainsFunc(migrations, func(mig migration) bool {
+		return mig.Name == target
+	}) {
+		return nil, fmt.Errorf("migrate: unknown migration %s", target)
+	}
+
+	result, err := m.migrate(ctx, nil, migrations, target)
+	applied := []string{}
+	for _, a := range result.Applied {
+		applied = append(applied, a.Name)
+	}
+
+	return applied, err
+}
+
+// migrate applies the pending migrations.
+// If target isn't empty, only the pending migrations up to and including the named target are applied,
+// and none are applied if the target has already been applied.
+// If conn isn't nil, the migrations are applied on it instead of a connection acquired from the database.
+func (m *Migrator) migrate(ctx context.Context, conn *sql.Conn, migrations []migration, target string) (result Result, err error) {
+	start := time.Now()
+	if m.timeout > 0 {
+		timeout := fmt.Errorf("migrate timed out after %s", m.timeout)
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeoutCause(ctx, m.timeout, timeout)
+		defer cancel()
+
+		defer func() {
+			if err != nil && context.Cause(ctx) == timeout {
+				err = fmt.Errorf("%w: %w", timeout, err)
+			}
+		}()
+	}
+
+	guarded := m.guarded
+	if conn != nil {
+		guarded = func(ctx context.Context, migrations []migration, f func(context.Context, *sql.Conn) error) error {
+			return m.guardedConn(ctx, conn, migrations, f)
+		}
+	}
+
+	n := len(migrations)
+	if target != "" {
+		n = slices.IndexFunc(migrations, func(mig migration) bool {
+			return mig.Name == target
+		}) + 1
+	}
+
+	included := bySum(migrations[:n])
+	counted := false // whether an attempt has counted the migrations that are up to date
+	attempt := func() (executed bool, err error) {
+		err = guarded(ctx, migrations, func(ctx context.Context, conn *sql.Conn) (err error) {
+			pending, upToDate, err := m.pending(ctx, conn, migrations)
+			if err != nil {
+				return err
+			}
+
+			if !counted {
+				for _, mig := range upToDate {
+					if _, ok := included[mig.Sum]; ok {
+						result.UpToDate++
+					}
+				}
+
+				counted = true
+			}
+
+			rec, err := m.prepareRecorder(ctx, conn)
+			if err != nil {
+				return err
+			}
+
+			defer func() {
+				err = errors.Join(err, rec.Close())
+			}()
+
+			var tx *sql.Tx
+			if m.singleTransaction {
+				if tx, err = conn.BeginTx(ctx, nil); err != nil {
+					return fmt.Errorf("begin: %w", err)
+				}
+
+				defer func() {
+					if err == nil {
+						if err = tx.Commit(); err != nil {
+							err = fmt.Errorf("commit: %w", err)
+						}
+					} else {
+						err = errors.Join(err, tx.Rollback())
+					}
+
+					// nothing was applied
+					if err != nil {
+						result.Applied = nil
+					}
+				}()
+			}
+
+			pending = slices.DeleteFunc(pending, func(mig migration) bool {
+				_, ok := included[mig.Sum]
+				return !ok
+			})
+
+			// migrations ordered before an applied target aren't applied
+			if target != "" && !slices.ContainsFunc(pending, func(mig migration) bool {
+				return mig.Name == target
+			}) {
+				pending = nil
+			}
+
+			var errs []error
+			for i, mig := range pending {
+				// stop between migrations if ctx is cancelled
+				if err := ctx.Err(); err != nil {
+					return errors.Join(append(errs, err)...)
+				}
+
+				if m.progress != nil {
+					m.progress(i, len(pending), mig.Name)
+				}
+
+				d, err := m.applyHooked(ctx, conn, tx, rec, mig)
+				if err != nil && tx == nil && m.outsideTransaction(mig) {
+					// the migration may have changed the database, so it can't be retried
+					executed = true
+				}
+
+				if err != nil && m.continueOnError && tx == nil {
+					errs = append(errs, err)
+					continue
+				}
+
+				if err != nil {
+					return err
+				}
+
+				result.Applied = append(result.Applied, AppliedMigration{Name: mig.Name, Sum: mig.Sum, Duration: d})
+			}
+
+			return errors.Join(errs...)
+		})
+
 		return
 	}
 
-	conn, err := m.db.Conn(ctx)
+	if conn != nil {
+		// a caller's connection can't be replaced, so retrying would reuse it
+		_, err = attempt()
+	} else {
+		err = m.retry(ctx, attempt)
+	}
+
+	m.logger.InfoContext(ctx, "flit: migrate finished", "applied", len(result.Applied), "up_to_date", result.UpToDate, "error", err)
+	m.observe(Event{Kind: EventMigrateFinished, Duration: time.Since(start), Err: err})
+	return
+}
+
+// applyHooked applies a migration, calling the configured hooks before and after.
+// It returns how long it took to apply the migration.
+func (m *Migrator) applyHooked(ctx context.Context, conn *sql.Conn, tx *sql.Tx, rec *recorder, mig migration) (time.Duration, error) {
+	if m.beforeEach != nil {
+		if err := m.beforeEach(ctx, mig.Name); err != nil {
+			return 0, fmt.Errorf("before %s: %w", mig.Name, err)
+		}
+	}
+
+	m.logger.InfoContext(ctx, "flit: applying migration", "name", mig.Name)
+	start := time.Now()
+	var err error
+	if tx != nil {
+		err = m.applyInTx(ctx, tx, rec, mig)
+	} else {
+		err = m.apply(ctx, conn, rec, mig)
+	}
+
+	d := time.Since(start)
+	if err != nil {
+		m.logger.ErrorContext(ctx, "flit: migration failed", "name", mig.Name, "duration", d, "error", err)
+	} else {
+		m.logger.InfoContext(ctx, "flit: applied migration", "name", mig.Name, "duration", d)
+	}
+
+	m.observe(Event{Kind: EventMigrationApplied, Name: mig.Name, Duration: d, Err: err})
+
+	if m.afterEach != nil {
+		if herr := m.afterEach(ctx, mig.Name, err); herr != nil && herr != err {
+			err = errors.Join(err, fmt.Errorf("after %s: %w", mig.Name, herr))
+		}
+	}
+
+	return d, err
+}
+
+// A Migration describes a migration loaded by [Migrator.Migrations].
+type Migration struct {
+	Name string
+
+	// Sum identifies the migration in the "flits" table. It is the hex-encoded hash of the file name
+	// computed with the configured hasher (SHA-256 by default); see [Migrator.SumFor].
+	Sum string
+
+	SQL string // empty for migrations registered with [Migrator.Register]
+}
+
+// Migrations returns every migration, applied or not, ordered by name.
+// It loads the migrations as [Migrator.Migrate] does but doesn't access the database.
+func (m *Migrator) Migrations() ([]Migration, error) {
+	migrations, err := m.loadMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	exported := []Migration{}
+	for _, mig := range migrations {
+		c, err := mig.content()
+		if err != nil {
+			return nil, err
+		}
+
+		exported = append(exported, Migration{Name: mig.Name, Sum: mig.Sum, SQL: c.SQL})
+	}
+
+	return exported, nil
+}
+
+// Plan reports the migrations [Migrator.Migrate] would apply, in the order it would apply them.
+// It performs the same checks as Migrate but doesn't execute any migrations or record them,
+// and doesn't change the database other than creating the "flits" table if it doesn't exist,
+// or upgrading a table created by an older version of Flit as Migrate does.
+func (m *Migrator) Plan(ctx context.Context) (planned []string, err error) {
+	pending, err := m.plan(ctx)
+	for _, mig := range pending {
+		planned = append(planned, mig.Name)
+	}
+
+	return
+}
+
+// plan returns the migrations [Migrator.Migrate] would apply, in the order it would apply them.
+func (m *Migrator) plan(ctx context.Context) (pending []migration, err error) {
+	migrations, err := m.loadMigrations()
 	if err != nil {
 		return
 	}
 
-	defer conn.Close()
+	err = m.guarded(ctx, migrations, func(ctx context.Context, conn *sql.Conn) error {
+		pending, _, err = m.pending(ctx, conn, migrations)
+		return err
+	})
 
-	err = m.guard(ctx, conn, func(ctx context.Context, conn *sql.Conn) error {
-		if _, err := conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS flits (sum CHAR(64) PRIMARY KEY);`); err != nil {
-			return fmt.Errorf("create flits table: %w", err)
+	return
+}
+
+// pending returns the migrations that haven't been applied, ordered by name.
+// If a migration failed partway through, the database is dirty and nothing is pending.
+// If checksum verification is enabled, the applied migrations are verified first.
+// Applied migrations that no longer exist are an error if strict orphan detection is enabled,
+// and are logged otherwise.
+// If strict ordering is enabled, a pending migration ordered before an applied migration is an error.
+// The content of every pending migration is read.
+// The migrations that are applied and don't need to be applied again are returned as upToDate.
+func (m *Migrator) pending(ctx context.Context, conn *sql.Conn, migrations []migration) (pending, upToDate []migration, err error) {
+	dirty, err := m.getDirtyMigrations(ctx, conn)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(dirty) > 0 {
+		return nil, nil, fmt.Errorf("%w: %s failed", ErrDirty, strings.Join(dirty, ", "))
+	}
+
+	completed, err := m.getCompletedMigrations(ctx, conn)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if m.verifyChecksum {
+		if err := verifyChecksums(completed, migrations); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	var (
+		repeatable []migration // applied after the versioned migrations
+		latest     string      // the name of the last applied migration
+	)
+
+	for _, mig := range migrations {
+		checksum, ok := completed[mig.Sum]
+		delete(completed, mig.Sum)
+
+		// changed repeatable migrations are applied again
+		changed := false
+		if ok && mig.Repeatable {
+			current, err := mig.checksum()
+			if err != nil {
+				return nil, nil, err
+			}
+
+			changed = checksum != current
 		}
 
-		completed, err := getCompletedMigrations(ctx, conn)
+		if ok && !changed {
+			upToDate = append(upToDate, mig)
+			if !mig.Repeatable {
+				latest = mig.Name
+			}
+
+			continue
+		}
+
+		c, err := mig.content()
 		if err != nil {
-			return err
+			return nil, nil, err
 		}
 
-		var pending []migration
-		for sum, m := range migrations {
-			if !slices.Contains(completed, sum) {
-				pending = append(pending, m)
+		switch {
+		case !ok && m.skipEmpty && mig.Func == nil && isBlank(c.SQL):
+			m.logger.WarnContext(ctx, "flit: skipped empty migration", "name", mig.Name)
+		case mig.Repeatable:
+			repeatable = append(repeatable, mig)
+		default:
+			pending = append(pending, mig)
+		}
+	}
+
+	if m.strictOrdering {
+		for _, mig := range pending {
+			if latest != "" && m.sort(mig.Name, latest) < 0 {
+				return nil, nil, fmt.Errorf("%w: %s is pending but %s is applied", ErrOutOfOrder, mig.Name, latest)
 			}
 		}
+	}
+
+	// the remaining sums don't match a migration
+	if len(completed) > 0 {
+		orphans := slices.Sorted(maps.Keys(completed))
+		if m.strictOrphans {
+			return nil, nil, fmt.Errorf("%w: %s", ErrOrphanedMigration, strings.Join(orphans, ", "))
+		}
+
+		m.logger.WarnContext(ctx, "flit: orphaned migrations", "sums", orphans)
+	}
+
+	return append(pending, repeatable...), upToDate, nil
+}
 
-		// sort pending migrations by name
-		slices.SortFunc(pending, func(a, b migration) int {
-			return strings.Compare(a.Name, b.Name)
+// An execer executes SQL statements. It is implemented by [*sql.Conn] and [*sql.Tx].
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+// apply executes a migration and records it as completed.
+// If transactions are enabled both steps of a SQL migration are done in a single transaction.
+// Otherwise the migration is recorded as dirty before it is executed,
+// and marked clean after it succeeds, so a failure leaves the database dirty.
+func (m *Migrator) apply(ctx context.Context, conn *sql.Conn, rec *recorder, mig migration) (err error) {
+	if mig.Func != nil {
+		return applyDirty(ctx, rec, mig, func() error {
+			return mig.Func(ctx, conn)
 		})
+	}
 
-		for _, m := range pending {
-			if _, err := conn.ExecContext(ctx, m.SQL); err != nil {
-				return fmt.Errorf("apply %s: %w", m.Name, err)
-			}
+	c, err := mig.content()
+	if err != nil {
+		return err
+	}
 
-			if _, err := conn.ExecContext(ctx, "INSERT INTO flits (sum) VALUES (?)", m.Sum); err != nil {
-				return fmt.Errorf("record %s: %w", m.Name, err)
-			}
+	if !m.transactions || c.NoTransaction {
+		return applyDirty(ctx, rec, mig, func() error {
+			return m.execScript(ctx, conn, c.SQL)
+		})
+	}
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin %s: %w", mig.Name, err)
+	}
+
+	defer func() {
+		if err != nil {
+			err = errors.Join(err, tx.Rollback())
+			return
+		}
+
+		if err = tx.Commit(); err != nil {
+			err = fmt.Errorf("commit %s: %w", mig.Name, err)
+		}
+	}()
+
+	if err := m.execScript(ctx, tx, c.SQL); err != nil {
+		return fmt.Errorf("apply %s: %w", mig.Name, err)
+	}
 
-			applied = append(applied, m.Name)
+	return rec.record(ctx, tx, mig, false)
+}
+
+// outsideTransaction reports whether [Migrator.apply] executes the migration outside a transaction.
+func (m *Migrator) outsideTransaction(mig migration) bool {
+	if mig.Func != nil || !m.transactions {
+		return true
+	}
+
+	c, err := mig.content()
+	return err == nil && c.NoTransaction
+}
+
+// applyInTx executes a migration and records it as completed in the single transaction
+// used by [WithSingleTransaction].
+func (m *Migrator) applyInTx(ctx context.Context, tx *sql.Tx, rec *recorder, mig migration) error {
+	if mig.Func != nil {
+		return fmt.Errorf("apply %s: registered functions can't run in a single transaction", mig.Name)
+	}
+
+	c, err := mig.content()
+	if err != nil {
+		return err
+	}
+
+	if c.NoTransaction {
+		return fmt.Errorf("apply %s: migrations that run outside a transaction can't run in a single transaction", mig.Name)
+	}
+
+	if err := m.execScript(ctx, tx, c.SQL); err != nil {
+		return fmt.Errorf("apply %s: %w", mig.Name, err)
+	}
+
+	return rec.record(ctx, tx, mig, false)
+}
+
+// applyDirty records a migration as dirty, calls f to execute it, and marks it clean if f succeeds.
+func applyDirty(ctx context.Context, rec *recorder, mig migration, f func() error) error {
+	if err := rec.record(ctx, nil, mig, true); err != nil {
+		return err
+	}
+
+	if err := f(); err != nil {
+		return fmt.Errorf("apply %s: %w", mig.Name, err)
+	}
+
+	return rec.clean(ctx, mig)
+}
+
+// guarded acquires a connection, calls the configured guard,
+// and ensures the configured table exists and its sums are up to date for the given migrations before calling f.
+func (m *Migrator) guarded(ctx context.Context, migrations []migration, f func(context.Context, *sql.Conn) error) error {
+	if m.err != nil {
+		return m.err
+	}
+
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer conn.Close()
+
+	return m.guardedConn(ctx, conn, migrations, f)
+}
+
+// guardedConn is like guarded, but uses the given connection instead of acquiring one.
+func (m *Migrator) guardedConn(ctx context.Context, conn *sql.Conn, migrations []migration, f func(context.Context, *sql.Conn) error) error {
+	if m.err != nil {
+		return m.err
+	}
+
+	var acquired bool
+	start := time.Now()
+	err := m.guard(ctx, conn, func(ctx context.Context, conn *sql.Conn) error {
+		acquired = true
+		m.logger.DebugContext(ctx, "flit: lock acquired")
+		m.observe(Event{Kind: EventLockAcquired, Duration: time.Since(start)})
+
+		if err := m.ensureTable(ctx, conn); err != nil {
+			return err
+		}
+
+		m.logger.DebugContext(ctx, "flit: table ensured", "table", m.table)
+		if err := m.upgradeSums(ctx, conn, migrations); err != nil {
+			return err
 		}
 
-		return nil
+		return f(ctx, conn)
 	})
 
-	return
+	if acquired {
+		m.logger.DebugContext(ctx, "flit: lock released")
+	} else if err != nil {
+		m.observe(Event{Kind: EventLockAcquired, Duration: time.Since(start), Err: err})
+	}
+
+	return err
 }
 
-// loadMigrations reads every migration file matching the configured glob
-// and returns a mapping keyed by the sha256 checksum of the file path.
-func (m *Migrator) loadMigrations() (map[string]migration, error) {
-	names, err := fs.Glob(m.fs, m.glob)
+// loadMigrations lists every migration file in the source,
+// adds the registered migration functions, and returns the migrations ordered by name.
+// The files aren't read until their content is needed.
+// Down scripts are attached to their up migration and are not migrations themselves.
+func (m *Migrator) loadMigrations() ([]migration, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+
+	names, err := m.source.Names()
 	if err != nil {
 		return nil, err
 	}
 
-	stmts := make(map[string]migration)
+	names, err = m.exclude(names)
+	if err != nil {
+		return nil, err
+	}
+
+	var migrations []migration
 	for _, name := range names {
-		data, err := fs.ReadFile(m.fs, name)
-		if err != nil {
-			return nil, err
+		if strings.HasSuffix(name, downSuffix) {
+			continue
+		}
+
+		if m.namePattern != nil && !m.isRepeatable(name) && !m.namePattern.MatchString(path.Base(name)) {
+			return nil, fmt.Errorf("migration %s doesn't match the name pattern %s", name, m.namePattern)
 		}
 
-		shasum := sha256.Sum256([]byte(name))
-		hexsum := hex.EncodeToString(shasum[:])
+		read := sync.OnceValues(func() (*content, error) {
+			return m.readContent(name)
+		})
+
+		migrations = append(migrations, migration{
+			Sum:        m.sum(name),
+			Name:       name,
+			Repeatable: m.isRepeatable(name),
+			read:       read,
+			hash: sync.OnceValues(func() (string, error) {
+				return m.hashContent(name, read)
+			}),
+		})
+	}
+
+	for name, f := range m.funcs {
+		if slices.Contains(names, name) {
+			return nil, fmt.Errorf("migration %s is both a file and a registered function", name)
+		}
 
-		stmts[hexsum] = migration{
-			Sum:  hexsum,
+		migrations = append(migrations, migration{
+			Sum:  m.sum(name),
 			Name: name,
-			SQL:  string(data),
+			Func: f,
+		})
+	}
+
+	slices.SortFunc(migrations, func(a, b migration) int {
+		return m.sort(a.Name, b.Name)
+	})
+
+	// migrations are identified by their file names
+	seen := make(map[string]string)
+	for _, mig := range migrations {
+		if other, ok := seen[mig.Sum]; ok {
+			return nil, fmt.Errorf("migrations %s and %s have the same file name", other, mig.Name)
+		}
+
+		seen[mig.Sum] = mig.Name
+	}
+
+	if m.uniqueVersions {
+		if err := checkDuplicateVersions(migrations); err != nil {
+			return nil, err
+		}
+	}
+
+	if m.noGaps {
+		if err := checkGaps(migrations); err != nil {
+			return nil, err
+		}
+	}
+
+	return migrations, nil
+}
+
+// A MigrationFunc is a migration implemented in Go.
+// Register it with [Migrator.Register].
+type MigrationFunc func(ctx context.Context, conn *sql.Conn) error
+
+// Register adds a migration implemented in Go with the given name.
+// Registered migrations are ordered by name together with migration files,
+// and are recorded in the "flits" table the same way, so each is only applied once.
+// The name must not be the same as the name of a migration file.
+//
+// The function is called with the connection used by [Migrator.Migrate].
+// It is not called in a transaction, even if [WithTransactions] is configured;
+// it can begin its own transaction on the connection.
+func (m *Migrator) Register(name string, up MigrationFunc) {
+	if m.funcs == nil {
+		m.funcs = make(map[string]MigrationFunc)
+	}
+
+	m.funcs[name] = up
+}
+
+// bySum returns a mapping of the given migrations keyed by their sums.
+func bySum(migrations []migration) map[string]migration {
+	sums := make(map[string]migration, len(migrations))
+	for _, mig := range migrations {
+		sums[mig.Sum] = mig
+	}
+
+	return sums
+}
+
+// exclude removes the names matching any of the configured exclude patterns.
+func (m *Migrator) exclude(names []string) ([]string, error) {
+	var included []string
+	for _, name := range names {
+		excluded := false
+		for _, pattern := range m.excludes {
+			matchName, err := path.Match(pattern, name)
+			if err != nil {
+				return nil, err
+			}
+
+			matchBase, _ := path.Match(pattern, path.Base(name))
+			if matchName || matchBase {
+				excluded = true
+				break
+			}
+		}
+
+		if !excluded {
+			included = append(included, name)
 		}
 	}
 
-	return stmts, nil
+	return included, nil
+}
+
+// readContent reads the named migration file and its down script,
+// expanding include directives and rendering templates.
+// A file with section markers is split into its up section and its down section.
+func (m *Migrator) readContent(name string) (*content, error) {
+	data, err := readFile(m.source, name)
+	if err != nil {
+		return nil, err
+	}
+
+	if data, err = m.expand(name, data); err != nil {
+		return nil, err
+	}
+
+	if data, err = m.render(name, data); err != nil {
+		return nil, err
+	}
+
+	up, down, err := splitSections(name, string(data))
+	if err != nil {
+		return nil, err
+	}
+
+	downScript, err := m.loadDown(name)
+	switch {
+	case err != nil:
+		return nil, err
+	case down != nil && downScript != nil:
+		return nil, fmt.Errorf("migration %s has both a down section and a down script", name)
+	case downScript != nil:
+		down = downScript
+	}
+
+	// the checksum covers both sections
+	return &content{
+		Checksum:      m.hash(data),
+		SQL:           up,
+		Down:          down,
+		NoTransaction: hasNoTransaction(up) || beginsTransaction(up),
+	}, nil
+}
+
+// loadDown reads the down script paired with the named migration, if there is one.
+// The down script for "001-first.sql" is "001-first.down.sql".
+func (m *Migrator) loadDown(name string) (*string, error) {
+	downName := strings.TrimSuffix(name, ".sql") + downSuffix
+	data, err := readFile(m.source, downName)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if data, err = m.expand(downName, data); err != nil {
+		return nil, err
+	}
+
+	if data, err = m.render(downName, data); err != nil {
+		return nil, err
+	}
+
+	down := string(data)
+	return &down, nil
 }
 
 // WithGlob configures Flit to load migration files matching the given glob.
+// It is shorthand for [WithGlobs] with a single pattern.
 func WithGlob(glob string) ConfigOption {
+	return WithGlobs(glob)
+}
+
+// WithGlobs configures Flit to load migration files matching any of the given globs.
+// A file matched by more than one glob is loaded once,
+// and the migrations from every glob are ordered by name together.
+func WithGlobs(globs ...string) ConfigOption {
+	return func(c *Migrator) {
+		c.globs = globs
+	}
+}
+
+// WithExclude configures Flit to ignore files matching any of the given patterns,
+// which use the syntax of [path.Match].
+// A pattern matches a file if it matches either its name or its base name,
+// so WithExclude("*_helper.sql") ignores helper files in every directory.
+// Excluded files are never read, applied, or recorded.
+func WithExclude(patterns ...string) ConfigOption {
+	return func(c *Migrator) {
+		c.excludes = append(c.excludes, patterns...)
+	}
+}
+
+// WithRecursive configures Flit to load migration files from every directory in the file system,
+// not only its root.
+// The configured globs are matched against the base name of each file, so the default loads every .sql file.
+// A migration's name is its slash-separated path relative to the root, such as "2025/001-first.sql",
+// so migrations are ordered by their full paths: every migration in "2024/" is applied before any in "2025/",
+// and a file in the root such as "3000-last.sql" is ordered between directories by its name.
+// File names must be unique across directories, because migrations are identified by their file names.
+func WithRecursive() ConfigOption {
 	return func(c *Migrator) {
-		c.glob = glob
+		c.recursive = true
 	}
 }
 
 // WithGuard configures Flit to call the given [GuardFunc] for concurrency control.
 // For example, [GuardMySQL] uses MySQL's GET_LOCK and RELEASE_LOCK functions.
+// [GuardPostgres] uses PostgreSQL's session-level advisory locks.
+// [GuardSQLite] uses SQLite's database write lock.
+// [GuardMSSQL] uses SQL Server's application locks.
+// These guards return an error before locking if the connection's driver is a well-known driver for another database,
+// such as when GuardMySQL is used with SQLite.
 func WithGuard(g GuardFunc) ConfigOption {
 	return func(c *Migrator) {
 		c.guard = g
 	}
 }
 
-// getCompletedMigrations loads the checksums of completed migrations from the flits table.
-func getCompletedMigrations(ctx context.Context, conn *sql.Conn) (completed []string, err error) {
-	rows, err := conn.QueryContext(ctx, "SELECT sum FROM flits")
-	if err != nil {
-		panic(err)
+// WithTable configures Flit to record completed migrations in the named table instead of "flits".
+// The name may be qualified with a schema, such as "migrations.flits",
+// to keep the table out of the default schema; the schema must already exist.
+// On SQLite the qualifier names an attached database instead.
+//
+// Each part of the name may only contain letters, digits, and underscores, and must not start with a digit.
+// Each part is quoted in SQL statements according to the dialect configured by [WithDialect],
+// so it can be a reserved word and keeps its case, even on PostgreSQL, which folds unquoted names to lower case.
+// An invalid name is reported by every operation of the [Migrator].
+func WithTable(name string) ConfigOption {
+	return func(c *Migrator) {
+		parts := strings.Split(name, ".")
+		if len(parts) > 2 || slices.ContainsFunc(parts, func(part string) bool {
+			return !identifierPattern.MatchString(part)
+		}) {
+			c.err = fmt.Errorf("invalid table name %q", name)
+			return
+		}
+
+		c.table = name
+	}
+}
+
+// quotedTable returns the name of the configured table, with each part quoted for the dialect.
+func (m *Migrator) quotedTable() string {
+	parts := strings.Split(m.table, ".")
+	for i, part := range parts {
+		parts[i] = m.dialect.quote(part)
 	}
 
-	defer rows.Close()
+	return strings.Join(parts, ".")
+}
 
-	for rows.Next() {
-		var sum string
-		if err := rows.Scan(&sum); err != nil {
-			return nil, err
+// WithTransactions configures Flit to apply each migration in a transaction.
+// The migration's SQL and the row recording its completion are committed together,
+// so a failure can't leave a migration applied but unrecorded.
+//
+// Some databases, including MySQL, implicitly commit DDL statements such as CREATE TABLE,
+// so migrations containing DDL are not atomic on those databases.
+// SQLite and PostgreSQL support transactional DDL.
+//
+// A migration with the comment "-- flit:no-transaction" on its own line,
+// among the comments before its first statement or right after its "-- +flit Up" marker,
+// runs outside a transaction,
+// for statements that can't run in one, such as PostgreSQL's CREATE INDEX CONCURRENTLY.
+// Like any migration run without a transaction,
+// it is recorded as dirty until it succeeds, so a failure partway through blocks [Migrator.Migrate].
+//
+// A migration that begins its own transaction also runs outside Flit's transaction,
+// because most databases can't nest transactions.
+// A migration begins its own transaction if its first statement, ignoring whitespace,
+// "--" comments, and "/* */" comments, is BEGIN or START TRANSACTION, in any case.
+func WithTransactions() ConfigOption {
+	return func(c *Migrator) {
+		c.transactions = true
+	}
+}
+
+// hasNoTransaction reports whether the noTransaction directive is a line of the comments
+// and blank lines before the SQL's first statement.
+// Section markers are removed before the SQL is checked,
+// so a directive right after the up marker is among these lines too.
+func hasNoTransaction(sql string) bool {
+	for line := range strings.Lines(sql) {
+		switch line = strings.TrimSpace(line); {
+		case line == noTransaction:
+			return true
+		case line != "" && !strings.HasPrefix(line, "--"):
+			return false
+		}
+	}
+
+	return false
+}
+
+// beginsTransaction reports whether the first statement of the SQL begins a transaction,
+// as described by [WithTransactions].
+func beginsTransaction(sql string) bool {
+	for {
+		sql = strings.TrimSpace(sql)
+		switch {
+		case strings.HasPrefix(sql, "--"):
+			_, sql, _ = strings.Cut(sql, "\n")
+		case strings.HasPrefix(sql, "/*"):
+			_, sql, _ = strings.Cut(sql, "*/")
+		default:
+			var words []string
+			for word := range strings.FieldsFuncSeq(sql, func(r rune) bool {
+				return r == ';' || unicode.IsSpace(r)
+			}) {
+				if words = append(words, word); len(words) == 2 {
+					break
+				}
+			}
+
+			return len(words) > 0 && strings.EqualFold(words[0], "BEGIN") ||
+				len(words) > 1 && strings.EqualFold(words[0], "START") && strings.EqualFold(words[1], "TRANSACTION")
 		}
+	}
+}
 
-		completed = append(completed, sum)
+// WithSingleTransaction configures Flit to apply all pending migrations in one transaction,
+// committed after the last one succeeds, so a failure rolls back the whole deployment
+// and [Migrator.Migrate] returns no applied migrations.
+// It takes precedence over [WithTransactions] and [WithContinueOnError].
+//
+// Only databases with transactional DDL, such as PostgreSQL and SQLite, can roll back schema changes;
+// MySQL implicitly commits DDL statements.
+// Migrations that run outside a transaction, as described by [WithTransactions],
+// and migrations registered with [Migrator.Register] can't run in the transaction, so Migrate fails if either is pending.
+// [GuardSQLite] already runs everything in a transaction and can't be combined with this option.
+func WithSingleTransaction() ConfigOption {
+	return func(c *Migrator) {
+		c.singleTransaction = true
 	}
+}
 
-	if err := rows.Err(); err != nil {
-		return nil, err
+// WithStatementSplitter configures Flit to split migrations into statements with the given function.
+// The default splitter splits after every semicolon at the end of a line,
+// ignoring semicolons in single-quoted string literals, PostgreSQL's dollar-quoted strings such as "$$ ... $$",
+// "--" comments, and "/* */" comments.
+// A custom splitter is useful for migrations that define stored procedures or triggers
+// whose bodies contain semicolons outside dollar quotes, as MySQL's do.
+// To execute each migration as a single statement, use a splitter that returns its input.
+func WithStatementSplitter(split func(string) []string) ConfigOption {
+	return func(c *Migrator) {
+		c.split = split
+	}
+}
+
+// WithChecksumVerification configures Flit to verify the content of applied migrations.
+// When enabled, [Migrator.Migrate] compares the checksum recorded when each migration was applied
+// with the checksum of its current content, and returns an error wrapping [ErrChecksumMismatch]
+// naming every migration that differs.
+// Migrations recorded by older versions of Flit, which didn't record checksums, are not verified.
+// Otherwise Migrate only reads the files of pending and repeatable migrations.
+func WithChecksumVerification(verify bool) ConfigOption {
+	return func(c *Migrator) {
+		c.verifyChecksum = verify
 	}
+}
 
-	return
+// WithStrictOrphans configures Flit to refuse to migrate when a migration recorded as applied
+// no longer exists in the file system, which usually means a migration file was deleted.
+// [Migrator.Migrate] returns an error wrapping [ErrOrphanedMigration] listing the sums of the missing migrations.
+// Without this option, orphaned migrations are logged as a warning.
+func WithStrictOrphans() ConfigOption {
+	return func(c *Migrator) {
+		c.strictOrphans = true
+	}
+}
+
+// WithStrictOrdering configures Flit to refuse to migrate when a pending migration
+// is ordered before a migration that has already been applied,
+// which usually means a migration was added with an out-of-date name.
+// [Migrator.Migrate] returns an error wrapping [ErrOutOfOrder]
+// naming the pending migration and the last applied migration.
+// Without this option, such migrations are applied.
+func WithStrictOrdering() ConfigOption {
+	return func(c *Migrator) {
+		c.strictOrdering = true
+	}
+}
+
+// WithContinueOnError configures Flit to keep applying migrations after one fails.
+// [Migrator.Migrate] returns the migrations that succeeded, which are recorded as usual,
+// along with an error joining the errors of every migration that failed.
+// Unless [WithTransactions] is used, failed migrations are recorded as dirty,
+// so the next Migrate returns [ErrDirty] until they're repaired.
+// By default Migrate stops at the first failure.
+func WithContinueOnError() ConfigOption {
+	return func(c *Migrator) {
+		c.continueOnError = true
+	}
+}
+
+// WithNamePattern configures Flit to reject migration files whose base names don't match the pattern,
+// catching typos that would silently change the order of migrations.
+// [Migrator.Migrate] and every other operation that loads migrations return an error naming the first such file.
+// Repeatable migrations, down scripts, and migrations registered with [Migrator.Register] aren't checked.
+// By default any name is accepted; see [DefaultNamePattern] for a conventional pattern.
+func WithNamePattern(pattern *regexp.Regexp) ConfigOption {
+	return func(c *Migrator) {
+		c.namePattern = pattern
+	}
+}
+
+// WithSkipEmpty configures Flit to skip migration files that are empty
+// or contain only whitespace, "--" comments, and "/* */" comments, such as files just created by the flit command.
+// Skipped files aren't executed or recorded, and a warning is logged,
+// so they're applied once they have content.
+// By default empty files are applied and recorded like any other migration.
+func WithSkipEmpty() ConfigOption {
+	return func(c *Migrator) {
+		c.skipEmpty = true
+	}
+}
+
+// WithTimeout configures Flit to stop [Migrator.Migrate] if it takes longer than d,
+// as if its context had a deadline d after it was called.
+// The error returned on expiry says that Migrate timed out,
+// and names the migration that was executing if there was one.
+//
+// The timeout includes the time spent waiting for the guard.
+// A guard with its own timeout, such as [GuardMySQLTimeout], gives up at whichever deadline comes first,
+// so its timeout should be shorter than d for its error to be returned.
+func WithTimeout(d time.Duration) ConfigOption {
+	return func(c *Migrator) {
+		c.timeout = d
+	}
+}
+
+// WithLogger configures Flit to log its progress with the given logger.
+// Migrations are logged at the info level as they are applied, with their durations,
+// and acquiring the guard and ensuring the table exists are logged at the debug level.
+// By default nothing is logged.
+func WithLogger(logger *slog.Logger) ConfigOption {
+	return func(c *Migrator) {
+		c.logger = logger
+	}
 }
 
 // mutexGuard is the default guard.
@@ -189,6 +1321,32 @@ type mutexGuard struct {
 	sync.Mutex
 }
 
+// dbMutexes maps weak pointers to the databases that migrators have been created with to their default guards.
+// The pointers are weak, and each database's entry is deleted when it is garbage collected,
+// so the map doesn't keep databases alive.
+var dbMutexes sync.Map
+
+// dbMutex returns the default guard shared by migrators created with the given database.
+// Only databases that are pointers, such as [*sql.DB], can be shared;
+// any other database gets its own guard, because its value can't be identified safely.
+func dbMutex(db DB) *mutexGuard {
+	v := reflect.ValueOf(db)
+	if !v.IsValid() || v.Kind() != reflect.Pointer || v.IsNil() {
+		return new(mutexGuard)
+	}
+
+	ptr := (*byte)(v.UnsafePointer())
+	key := weak.Make(ptr)
+	g, loaded := dbMutexes.LoadOrStore(key, new(mutexGuard))
+	if !loaded {
+		runtime.AddCleanup(ptr, func(key weak.Pointer[byte]) {
+			dbMutexes.Delete(key)
+		}, key)
+	}
+
+	return g.(*mutexGuard)
+}
+
 func (g *mutexGuard) Guard(ctx context.Context, conn *sql.Conn, f func(context.Context, *sql.Conn) error) error {
 	g.Lock()
 	defer g.Unlock()
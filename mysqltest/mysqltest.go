@@ -6,17 +6,62 @@ import (
 	"database/sql"
 	"encoding/hex"
 	"io"
+	"regexp"
+	"strings"
 	"testing"
 
 	"github.com/go-sql-driver/mysql"
 )
 
+// An Option configures the database created by [NewDB].
+type Option func(*config)
+
+type config struct {
+	charset   string
+	collation string
+}
+
+// namePattern matches valid character set and collation names.
+var namePattern = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+
+// WithCharset creates the database with the given character set and collation,
+// such as "utf8mb4" and "utf8mb4_unicode_ci", so tests match a production database.
+// Either may be empty to use the server's default.
+// By default the database uses the server's defaults for both.
+func WithCharset(charset, collation string) Option {
+	return func(c *config) {
+		c.charset = charset
+		c.collation = collation
+	}
+}
+
 // NewDB creates a new MySQL database that is dropped after the test.
 // It connects to the database described by templateDSN to execute CREATE DATABASE and DROP DATABASE statements.
 // The new database is named by adding a random suffix to the database name in templateDSN.
-func NewDB(t *testing.T, templateDSN string) *sql.DB {
+func NewDB(t *testing.T, templateDSN string, options ...Option) *sql.DB {
 	t.Helper()
 
+	var c config
+	for _, o := range options {
+		o(&c)
+	}
+
+	clauses := ""
+	for _, clause := range []struct{ keyword, name string }{
+		{"CHARACTER SET", c.charset},
+		{"COLLATE", c.collation},
+	} {
+		if clause.name == "" {
+			continue
+		}
+
+		if !namePattern.MatchString(clause.name) {
+			t.Fatalf("invalid %s %q", strings.ToLower(clause.keyword), clause.name)
+		}
+
+		clauses += " " + clause.keyword + " " + clause.name
+	}
+
 	template, err := mysql.ParseDSN(templateDSN)
 	if err != nil {
 		t.Fatal(err)
@@ -45,12 +90,12 @@ func NewDB(t *testing.T, templateDSN string) *sql.DB {
 		dsn.DBName = template.DBName + "_" + dsn.DBName
 	}
 
-	if _, err := root.Exec("CREATE DATABASE " + dsn.DBName); err != nil {
+	if _, err := root.Exec("CREATE DATABASE " + quoteIdentifier(dsn.DBName) + clauses); err != nil {
 		t.Fatalf("create %s: %v", dsn.DBName, err)
 	}
 
 	t.Cleanup(func() {
-		if _, err := root.Exec("DROP DATABASE " + dsn.DBName); err != nil {
+		if _, err := root.Exec("DROP DATABASE " + quoteIdentifier(dsn.DBName)); err != nil {
 			t.Errorf("drop %s: %v", dsn.DBName, err)
 		}
 	})
@@ -68,3 +113,8 @@ func NewDB(t *testing.T, templateDSN string) *sql.DB {
 
 	return db
 }
+
+// quoteIdentifier quotes a MySQL identifier with backticks, doubling any backticks it contains.
+func quoteIdentifier(name string) string {
+	return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+}
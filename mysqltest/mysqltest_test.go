@@ -0,0 +1,77 @@
+package mysqltest
+
+import (
+	"database/sql"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+func TestQuoteIdentifier(t *testing.T) {
+	tests := map[string]string{
+		"flit":        "`flit`",
+		"flit-test":   "`flit-test`",
+		"flit`; DROP": "`flit``; DROP`",
+		"``":          "``````",
+	}
+
+	for name, expect := range tests {
+		if got := quoteIdentifier(name); got != expect {
+			t.Errorf("quoteIdentifier(%q) = %q, expected %q", name, got, expect)
+		}
+	}
+}
+
+func TestNewDBQuotedTemplate(t *testing.T) {
+	dsn, ok := os.LookupEnv("TEST_MYSQL_DSN")
+	if !ok {
+		t.Skip("TEST_MYSQL_DSN is not set")
+	}
+
+	// a template database whose name needs quoting
+	root := NewDB(t, dsn)
+	template, err := mysql.ParseDSN(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template.DBName = "flit-te`st"
+	if _, err := root.Exec("CREATE DATABASE " + quoteIdentifier(template.DBName)); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		if _, err := root.Exec("DROP DATABASE " + quoteIdentifier(template.DBName)); err != nil {
+			t.Errorf("drop %s: %v", template.DBName, err)
+		}
+	})
+
+	db := NewDB(t, template.FormatDSN())
+	var name sql.NullString
+	if err := db.QueryRow("SELECT DATABASE()").Scan(&name); err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(name.String, template.DBName+"_mysqltest_") {
+		t.Errorf("expected a new database named after %q, got %q", template.DBName, name.String)
+	}
+}
+
+func TestNewDBWithCharset(t *testing.T) {
+	dsn, ok := os.LookupEnv("TEST_MYSQL_DSN")
+	if !ok {
+		t.Skip("TEST_MYSQL_DSN is not set")
+	}
+
+	db := NewDB(t, dsn, WithCharset("utf8mb4", "utf8mb4_unicode_ci"))
+	var charset, collation string
+	if err := db.QueryRow("SELECT @@character_set_database, @@collation_database").Scan(&charset, &collation); err != nil {
+		t.Fatal(err)
+	}
+
+	if charset != "utf8mb4" || collation != "utf8mb4_unicode_ci" {
+		t.Errorf("expected utf8mb4 and utf8mb4_unicode_ci, got %s and %s", charset, collation)
+	}
+}
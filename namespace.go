@@ -0,0 +1,34 @@
+package flit
+
+import (
+	"fmt"
+	"unicode/utf8"
+)
+
+// maxNamespaceLength is the maximum length, in characters, of a namespace.
+const maxNamespaceLength = 255
+
+// WithNamespace configures Flit to record migrations in the given namespace,
+// so that several applications can share the "flits" table, or the table configured by [WithTable].
+// Each migrator only sees the migrations recorded in its own namespace,
+// and the sums of namespaced migrations include the namespace,
+// so applications can have migrations with the same file names.
+//
+// The default namespace is empty, which is the namespace of migrations recorded by older versions of Flit.
+// Changing the namespace of an application makes its applied migrations pending again.
+func WithNamespace(name string) ConfigOption {
+	return func(c *Migrator) {
+		if n := utf8.RuneCountInString(name); n > maxNamespaceLength {
+			c.err = fmt.Errorf("namespace %q is %d characters, the maximum is %d", name, n, maxNamespaceLength)
+			return
+		}
+
+		c.namespace = name
+	}
+}
+
+// inNamespace returns a condition matching rows in the configured namespace,
+// whose value is the nth (1-based) argument of the statement.
+func (m *Migrator) inNamespace(n int) string {
+	return "namespace = " + m.dialect.placeholder(n)
+}
@@ -0,0 +1,47 @@
+package flit
+
+import "time"
+
+// An EventKind identifies what an [Event] describes.
+type EventKind int
+
+const (
+	// EventLockAcquired is observed when the guard has been acquired.
+	// Its duration is how long it took to acquire.
+	// If the guard fails without calling its function, the event is observed with the guard's error.
+	EventLockAcquired EventKind = iota + 1
+
+	// EventMigrationApplied is observed after each migration is applied, whether or not it succeeded.
+	// Its name is the migration's name and its duration is how long it took to apply.
+	EventMigrationApplied
+
+	// EventMigrateFinished is observed when [Migrator.Migrate] finishes, whether or not it succeeded.
+	// Its duration is how long Migrate took.
+	EventMigrateFinished
+)
+
+// An Event is passed to the observer configured by [WithObserver].
+type Event struct {
+	Kind     EventKind
+	Name     string        // the migration's name, for EventMigrationApplied
+	Duration time.Duration // how long the operation took
+	Err      error         // the error the operation failed with, or nil
+}
+
+// WithObserver configures Flit to call f with an [Event] when the guard is acquired,
+// when each migration is applied, and when [Migrator.Migrate] finishes,
+// so that metrics can be recorded with any metrics library.
+// The guard is acquired by every operation that reads the database, not only Migrate.
+// By default no observer is called.
+func WithObserver(f func(event Event)) ConfigOption {
+	return func(c *Migrator) {
+		c.observer = f
+	}
+}
+
+// observe calls the configured observer, if any.
+func (m *Migrator) observe(event Event) {
+	if m.observer != nil {
+		m.observer(event)
+	}
+}
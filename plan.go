@@ -0,0 +1,54 @@
+package flit
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+)
+
+// A jsonPlan is the document written by [Migrator.PlanJSON].
+type jsonPlan struct {
+	Migrations []jsonPlanned `json:"migrations"`
+}
+
+// A jsonPlanned describes a planned migration in a [jsonPlan].
+type jsonPlanned struct {
+	Name     string `json:"name"`
+	Sum      string `json:"sum"`
+	Checksum string `json:"checksum,omitempty"`
+}
+
+// PlanJSON writes the plan reported by [Migrator.Plan] to w as a JSON document,
+// so deploy tools can store it or compare it across environments.
+// Like Plan, it doesn't execute any migrations or record them.
+//
+// The document is an object with a "migrations" array,
+// which has an object for each migration in the order Migrate would apply them.
+// Each object has the migration's "name" and its "sum", which identifies it in the "flits" table.
+// If checksum verification is enabled with [WithChecksumVerification],
+// each object also has the "checksum" of the migration's content,
+// except for migrations registered with [Migrator.Register], which have no content.
+// The array is empty if no migrations are pending.
+// Fields may be added to the document, but existing fields won't be changed or removed.
+func (m *Migrator) PlanJSON(ctx context.Context, w io.Writer) error {
+	pending, err := m.plan(ctx)
+	if err != nil {
+		return err
+	}
+
+	plan := jsonPlan{Migrations: []jsonPlanned{}}
+	for _, mig := range pending {
+		p := jsonPlanned{Name: mig.Name, Sum: mig.Sum}
+		if m.verifyChecksum {
+			if p.Checksum, err = mig.checksum(); err != nil {
+				return err
+			}
+		}
+
+		plan.Migrations = append(plan.Migrations, p)
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(plan)
+}
@@ -0,0 +1,93 @@
+// Package postgrestest provides a helper to create test-scoped PostgreSQL databases.
+// It uses the github.com/lib/pq driver.
+package postgrestest
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"io"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/lib/pq"
+)
+
+// NewDB creates a new PostgreSQL database that is dropped after the test.
+// It connects to the database described by templateDSN to execute CREATE DATABASE and DROP DATABASE statements.
+// The new database is named by adding a random suffix to the database name in templateDSN.
+// The templateDSN can be a URL or a list of key=value settings.
+func NewDB(t *testing.T, templateDSN string) *sql.DB {
+	t.Helper()
+
+	root, err := sql.Open("postgres", templateDSN)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		if err := root.Close(); err != nil {
+			t.Errorf("close %s: %v", templateDSN, err)
+		}
+	})
+
+	var template string
+	if err := root.QueryRow("SELECT current_database()").Scan(&template); err != nil {
+		t.Fatal(err)
+	}
+
+	randomBytes := make([]byte, 16)
+	if _, err := io.ReadFull(rand.Reader, randomBytes); err != nil {
+		t.Fatal(err)
+	}
+
+	name := "postgrestest_" + hex.EncodeToString(randomBytes)
+	if template != "" {
+		name = template + "_" + name
+	}
+
+	dsn, err := withDBName(templateDSN, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := root.Exec("CREATE DATABASE " + pq.QuoteIdentifier(name)); err != nil {
+		t.Fatalf("create %s: %v", name, err)
+	}
+
+	t.Cleanup(func() {
+		if _, err := root.Exec("DROP DATABASE " + pq.QuoteIdentifier(name)); err != nil {
+			t.Errorf("drop %s: %v", name, err)
+		}
+	})
+
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		if err := db.Close(); err != nil {
+			t.Errorf("close %s: %v", name, err)
+		}
+	})
+
+	return db
+}
+
+// withDBName returns dsn changed to connect to the named database.
+func withDBName(dsn, name string) (string, error) {
+	if !strings.HasPrefix(dsn, "postgres://") && !strings.HasPrefix(dsn, "postgresql://") {
+		// later settings take precedence
+		return dsn + " dbname='" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(name) + "'", nil
+	}
+
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return "", err
+	}
+
+	u.Path = "/" + name
+	return u.String(), nil
+}
@@ -0,0 +1,93 @@
+package flit
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// A recorder records applied migrations in the configured table.
+// Its statements are prepared once on the guarded connection and reused for every migration,
+// so applying many migrations doesn't parse the same statements over and over.
+type recorder struct {
+	remove *sql.Stmt
+	insert *sql.Stmt
+	update *sql.Stmt
+
+	namespace string
+	metadata  sql.NullString
+}
+
+// prepareRecorder prepares the statements used to record migrations on the connection.
+// The caller must close the recorder.
+func (m *Migrator) prepareRecorder(ctx context.Context, conn *sql.Conn) (*recorder, error) {
+	p := m.dialect.placeholder
+	rec := &recorder{namespace: m.namespace, metadata: m.metadata}
+	for _, s := range []struct {
+		stmt  **sql.Stmt
+		query string
+	}{
+		{&rec.remove, "DELETE FROM " + m.quotedTable() + " WHERE sum = " + p(1)},
+		{&rec.insert, "INSERT INTO " + m.quotedTable() + " (sum, name, checksum, dirty, namespace, metadata, applied_at) VALUES (" + m.dialect.placeholders(6) + ", CURRENT_TIMESTAMP)"},
+		{&rec.update, "UPDATE " + m.quotedTable() + " SET dirty = " + m.dialect.boolean(false) + ", applied_at = CURRENT_TIMESTAMP WHERE sum = " + p(1)},
+	} {
+		stmt, err := conn.PrepareContext(ctx, s.query)
+		if err != nil {
+			return nil, errors.Join(fmt.Errorf("prepare %s statements: %w", m.table, err), rec.Close())
+		}
+
+		*s.stmt = stmt
+	}
+
+	return rec, nil
+}
+
+// record inserts the row recording that a migration was applied,
+// or that it is being applied if dirty is true.
+// The previous row of a repeatable migration is replaced.
+// If tx isn't nil the row is inserted in the transaction.
+func (r *recorder) record(ctx context.Context, tx *sql.Tx, mig migration, dirty bool) error {
+	remove, insert := r.remove, r.insert
+	if tx != nil {
+		remove, insert = tx.StmtContext(ctx, remove), tx.StmtContext(ctx, insert)
+	}
+
+	if mig.Repeatable {
+		if _, err := remove.ExecContext(ctx, mig.Sum); err != nil {
+			return fmt.Errorf("record %s: %w", mig.Name, err)
+		}
+	}
+
+	c, err := mig.content()
+	if err != nil {
+		return err
+	}
+
+	if _, err := insert.ExecContext(ctx, mig.Sum, mig.Name, sql.NullString{String: c.Checksum, Valid: c.Checksum != ""}, dirty, r.namespace, r.metadata); err != nil {
+		return fmt.Errorf("record %s: %w", mig.Name, err)
+	}
+
+	return nil
+}
+
+// clean marks a dirty migration as successfully applied.
+func (r *recorder) clean(ctx context.Context, mig migration) error {
+	if _, err := r.update.ExecContext(ctx, mig.Sum); err != nil {
+		return fmt.Errorf("record %s: %w", mig.Name, err)
+	}
+
+	return nil
+}
+
+// Close closes the recorder's prepared statements.
+func (r *recorder) Close() error {
+	var errs []error
+	for _, stmt := range []*sql.Stmt{r.remove, r.insert, r.update} {
+		if stmt != nil {
+			errs = append(errs, stmt.Close())
+		}
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,71 @@
+package flit
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// Repair fixes the recorded history after a failed deployment has been fixed by hand,
+// so that [Migrator.Migrate] can continue.
+//
+// Repair deletes the rows of dirty migrations, which failed partway through,
+// so they're applied again by the next Migrate.
+// If a dirty migration was completed by hand, record it with [Migrator.Baseline] or [Migrator.MarkApplied] instead,
+// which mark dirty migrations as applied.
+// Repair also rewrites the recorded checksum of every applied migration whose content has changed,
+// so that checksum verification accepts migrations that were legitimately edited after they were applied.
+// The checksums of repeatable migrations aren't rewritten, so changed ones are still applied again.
+// Every change is logged at the info level.
+//
+// Repair is guarded the same way as [Migrator.Migrate].
+func (m *Migrator) Repair(ctx context.Context) error {
+	migrations, err := m.loadMigrations()
+	if err != nil {
+		return err
+	}
+
+	return m.guarded(ctx, migrations, func(ctx context.Context, conn *sql.Conn) error {
+		dirty, err := m.getDirtyMigrations(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		if _, err := conn.ExecContext(ctx, "DELETE FROM "+m.quotedTable()+" WHERE dirty = "+m.dialect.boolean(true)+" AND "+m.inNamespace(1), m.namespace); err != nil {
+			return fmt.Errorf("repair: %w", err)
+		}
+
+		for _, name := range dirty {
+			m.logger.InfoContext(ctx, "flit: removed dirty migration", "name", name)
+		}
+
+		completed, err := m.getCompletedMigrations(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, mig := range migrations {
+			checksum, ok := completed[mig.Sum]
+			if !ok || mig.Repeatable {
+				continue
+			}
+
+			current, err := mig.checksum()
+			if err != nil {
+				return err
+			}
+
+			if current == "" || current == checksum {
+				continue
+			}
+
+			if _, err := conn.ExecContext(ctx, "UPDATE "+m.quotedTable()+" SET checksum = "+m.dialect.placeholder(1)+" WHERE sum = "+m.dialect.placeholder(2), current, mig.Sum); err != nil {
+				return fmt.Errorf("repair %s: %w", mig.Name, err)
+			}
+
+			m.logger.InfoContext(ctx, "flit: rewrote checksum", "name", mig.Name, "old", checksum, "new", current)
+		}
+
+		return nil
+	})
+}
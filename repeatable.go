@@ -0,0 +1,28 @@
+package flit
+
+import (
+	"path"
+	"strings"
+)
+
+// WithRepeatablePrefix configures Flit to treat migration files whose names begin with prefix,
+// such as "R__" in "R__create_views.sql", as repeatable.
+// The prefix is matched against the base name of the file.
+//
+// Unlike other migrations, which are applied once, a repeatable migration is applied again
+// by [Migrator.Migrate] whenever its content changes.
+// Repeatable migrations are applied after all other pending migrations, in name order,
+// so they should be idempotent, for example by using CREATE OR REPLACE VIEW.
+// They are exempt from checksum verification and strict ordering, and aren't reverted by [Migrator.Rollback].
+//
+// By default no migrations are repeatable.
+func WithRepeatablePrefix(prefix string) ConfigOption {
+	return func(c *Migrator) {
+		c.repeatable = prefix
+	}
+}
+
+// isRepeatable reports whether the named migration file is repeatable.
+func (m *Migrator) isRepeatable(name string) bool {
+	return m.repeatable != "" && strings.HasPrefix(path.Base(name), m.repeatable)
+}
@@ -0,0 +1,93 @@
+package flit
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// WithRetry configures Flit to retry [Migrator.Migrate] when it fails with a transient error,
+// such as a dropped connection or a deadlock, making up to attempts attempts in total.
+// It waits backoff before the first retry, and doubles the wait before each further retry.
+// The error returned after a retry says how many attempts were made.
+// Use [WithRetryIf] to configure which errors are retried.
+//
+// Each attempt acquires a new connection and the guard, then applies the migrations that are still pending,
+// so migrations applied by an earlier attempt aren't applied again.
+// An attempt is only retried if it failed before executing a migration, or while executing one in a transaction,
+// which is rolled back. A migration executed without a transaction, including a function registered with
+// [Migrator.Register], may have changed the database before it failed and is left dirty,
+// so its error is returned without retrying.
+// [Migrator.MigrateConn] isn't retried, because it can't acquire a new connection.
+// [WithTimeout] limits the total time spent on all attempts.
+func WithRetry(attempts int, backoff time.Duration) ConfigOption {
+	return func(c *Migrator) {
+		if attempts < 1 {
+			c.err = fmt.Errorf("retry: attempts must be positive, got %d", attempts)
+			return
+		}
+
+		c.retryAttempts = attempts
+		c.retryBackoff = backoff
+	}
+}
+
+// WithRetryIf configures which errors [WithRetry] retries.
+// By default, errors matching [driver.ErrBadConn], [io.ErrUnexpectedEOF], [syscall.ECONNRESET], or [syscall.EPIPE],
+// and errors whose messages mention a deadlock, are retried.
+func WithRetryIf(retryable func(error) bool) ConfigOption {
+	return func(c *Migrator) {
+		c.retryable = retryable
+	}
+}
+
+// isTransient reports whether err is likely to succeed if retried.
+// Drivers report deadlocks with their own error types,
+// such as MySQL's error 1213 and PostgreSQL's SQLSTATE 40P01,
+// but both mention a deadlock in their messages.
+func isTransient(err error) bool {
+	for _, target := range []error{driver.ErrBadConn, io.ErrUnexpectedEOF, syscall.ECONNRESET, syscall.EPIPE} {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+
+	return strings.Contains(strings.ToLower(err.Error()), "deadlock")
+}
+
+// retry calls f until it succeeds, fails with an error that isn't retryable,
+// or the attempts configured by [WithRetry] are exhausted.
+// An attempt that reports it executed a migration outside a transaction isn't retried.
+func (m *Migrator) retry(ctx context.Context, f func() (executed bool, err error)) error {
+	backoff := m.retryBackoff
+	for attempt := 1; ; attempt++ {
+		executed, err := f()
+		if err == nil {
+			return nil
+		}
+
+		if executed || attempt >= m.retryAttempts || !m.retryable(err) {
+			if attempt > 1 {
+				err = fmt.Errorf("failed after %d attempts: %w", attempt, err)
+			}
+
+			return err
+		}
+
+		m.logger.WarnContext(ctx, "flit: retrying", "attempt", attempt, "backoff", backoff, "error", err)
+		t := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return fmt.Errorf("failed after %d attempts: %w", attempt, errors.Join(err, context.Cause(ctx)))
+		case <-t.C:
+		}
+
+		backoff *= 2
+	}
+}
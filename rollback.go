@@ -0,0 +1,206 @@
+package flit
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Rollback reverts the most recently applied migrations.
+// It returns the names of the migrations that were rolled back.
+//
+// The last steps applied migrations are reverted, latest first.
+// Migrations are ordered by when they were applied, and migrations applied at the same time,
+// or recorded without a time by older versions of Flit, by name.
+// Each migration is reverted by executing its down script,
+// which is the file with the same name but a ".down.sql" extension.
+// For example, the down script for "001-first.sql" is "001-first.down.sql".
+// Alternatively, a migration file can contain its down script in a section after a "-- +flit Down" line,
+// optionally with its up script in a section after a "-- +flit Up" line at the start.
+// Each marker must be on a line of its own. A blank down section isn't a down script.
+// After a down script is executed the migration's row is deleted from the "flits" table,
+// or the table configured by [WithTable].
+//
+// Repeatable migrations aren't reverted.
+// If any migration to be reverted doesn't have a down script,
+// Rollback returns an error naming it before any down script is executed.
+// Like [Migrator.Migrate], it returns an error wrapping [ErrDirty] without reverting anything
+// if a migration failed partway through, since the database isn't in a known state.
+//
+// Rollback is guarded the same way as [Migrator.Migrate].
+func (m *Migrator) Rollback(ctx context.Context, steps int) (rolledBack []string, err error) {
+	if steps < 1 {
+		return nil, fmt.Errorf("rollback: steps must be positive, got %d", steps)
+	}
+
+	migrations, err := m.loadMigrations()
+	if err != nil {
+		return
+	}
+
+	err = m.guarded(ctx, migrations, func(ctx context.Context, conn *sql.Conn) error {
+		dirty, err := m.getDirtyMigrations(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		if len(dirty) > 0 {
+			return fmt.Errorf("%w: %s failed", ErrDirty, strings.Join(dirty, ", "))
+		}
+
+		applied, err := m.latestApplied(ctx, conn, migrations)
+		if err != nil {
+			return err
+		}
+
+		if len(applied) > steps {
+			applied = applied[:steps]
+		}
+
+		var (
+			downs   []string
+			missing []error
+		)
+
+		for _, mig := range applied {
+			c, err := mig.content()
+			if err != nil {
+				return err
+			}
+
+			if c.Down == nil {
+				missing = append(missing, fmt.Errorf("rollback %s: no down script", mig.Name))
+				continue
+			}
+
+			downs = append(downs, *c.Down)
+		}
+
+		if err := errors.Join(missing...); err != nil {
+			return err
+		}
+
+		for i, mig := range applied {
+			if err := m.revert(ctx, conn, mig, downs[i]); err != nil {
+				return err
+			}
+
+			rolledBack = append(rolledBack, mig.Name)
+		}
+
+		return nil
+	})
+
+	return
+}
+
+// Redo reverts the most recently applied migration, ordered as [Migrator.Rollback] orders them, and applies it again.
+// The migration is reverted by executing its down script, as [Migrator.Rollback] does,
+// and then applied as [Migrator.Migrate] would, recording its current checksum.
+// This makes it convenient to edit the latest migration and run it again during development.
+//
+// Redo returns an error if no migration has been applied, if the latest doesn't have a down script,
+// or if any migration is dirty. Repeatable migrations aren't redone.
+// Redo is guarded the same way as [Migrator.Migrate].
+func (m *Migrator) Redo(ctx context.Context) error {
+	migrations, err := m.loadMigrations()
+	if err != nil {
+		return err
+	}
+
+	return m.guarded(ctx, migrations, func(ctx context.Context, conn *sql.Conn) (err error) {
+		dirty, err := m.getDirtyMigrations(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		if len(dirty) > 0 {
+			return fmt.Errorf("%w: %s failed", ErrDirty, strings.Join(dirty, ", "))
+		}
+
+		applied, err := m.latestApplied(ctx, conn, migrations)
+		if err != nil {
+			return err
+		}
+
+		if len(applied) == 0 {
+			return errors.New("redo: no applied migrations")
+		}
+
+		mig := applied[0]
+		c, err := mig.content()
+		if err != nil {
+			return err
+		}
+
+		if c.Down == nil {
+			return fmt.Errorf("redo %s: no down script", mig.Name)
+		}
+
+		if err := m.revert(ctx, conn, mig, *c.Down); err != nil {
+			return err
+		}
+
+		rec, err := m.prepareRecorder(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		defer func() {
+			err = errors.Join(err, rec.Close())
+		}()
+
+		_, err = m.applyHooked(ctx, conn, nil, rec, mig)
+		return err
+	})
+}
+
+// revert executes a migration's down script and deletes its row.
+func (m *Migrator) revert(ctx context.Context, conn *sql.Conn, mig migration, down string) error {
+	if err := m.execScript(ctx, conn, down); err != nil {
+		return fmt.Errorf("revert %s: %w", mig.Name, err)
+	}
+
+	if _, err := conn.ExecContext(ctx, "DELETE FROM "+m.quotedTable()+" WHERE sum = "+m.dialect.placeholder(1), mig.Sum); err != nil {
+		return fmt.Errorf("unrecord %s: %w", mig.Name, err)
+	}
+
+	return nil
+}
+
+// latestApplied returns the completed migrations that aren't repeatable, latest first,
+// ordered as described by [Migrator.Rollback].
+// Migrations recorded without a time are ordered before those recorded with one.
+func (m *Migrator) latestApplied(ctx context.Context, conn *sql.Conn, migrations []migration) ([]migration, error) {
+	records, err := m.getRecordsBySum(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+
+	var applied []migration
+	for _, mig := range slices.Backward(migrations) {
+		if r, ok := records[mig.Sum]; ok && !r.Dirty && !mig.Repeatable {
+			applied = append(applied, mig)
+		}
+	}
+
+	// the stable sort keeps migrations applied at the same time in reverse name order
+	slices.SortStableFunc(applied, func(a, b migration) int {
+		at, bt := records[a.Sum].AppliedAt, records[b.Sum].AppliedAt
+		switch {
+		case at.Valid && bt.Valid:
+			return bt.Time.Compare(at.Time)
+		case at.Valid:
+			return -1
+		case bt.Valid:
+			return 1
+		}
+
+		return 0
+	})
+
+	return applied, nil
+}
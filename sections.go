@@ -0,0 +1,62 @@
+package flit
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Section markers divide a migration file into an up section, which is applied by [Migrator.Migrate],
+// and a down section, which is executed by [Migrator.Rollback].
+const (
+	upMarker   = "-- +flit Up"
+	downMarker = "-- +flit Down"
+)
+
+// splitSections splits the SQL of the named migration file into its up and down sections.
+// The up section is everything before the down marker, without the optional up marker,
+// and the down section is everything after the down marker.
+// If the file doesn't have a down marker, the whole file is the up section and down is nil.
+// Down is also nil if the down section is blank, as it is in files created by "flit new",
+// so the migration has no down script unless one is written.
+// A marker must be a line of its own, and each can be used at most once, with the up marker first.
+func splitSections(name, sql string) (up string, down *string, err error) {
+	if !strings.Contains(sql, "-- +flit") {
+		return sql, nil, nil
+	}
+
+	var (
+		b                strings.Builder
+		upSeen, downSeen bool
+	)
+
+	for line := range strings.Lines(sql) {
+		switch strings.TrimSpace(line) {
+		case upMarker:
+			if upSeen || downSeen {
+				return "", nil, fmt.Errorf("migration %s: unexpected %q", name, upMarker)
+			}
+
+			upSeen = true
+		case downMarker:
+			if downSeen {
+				return "", nil, fmt.Errorf("migration %s: unexpected %q", name, downMarker)
+			}
+
+			downSeen, up = true, b.String()
+			b.Reset()
+		default:
+			b.WriteString(line)
+		}
+	}
+
+	if !downSeen {
+		return b.String(), nil, nil
+	}
+
+	downSection := b.String()
+	if strings.TrimSpace(downSection) == "" {
+		return up, nil, nil
+	}
+
+	return up, &downSection, nil
+}
@@ -0,0 +1,186 @@
+package flit
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"slices"
+)
+
+// A Source provides migration files to a [Migrator].
+// Pass a Source to [NewWithSource] to load migrations from somewhere other than a file system,
+// such as an object store or a configuration service.
+type Source interface {
+	// Names returns the names of the migration files, including any down scripts.
+	Names() ([]string, error)
+
+	// Open opens the named file for reading.
+	// If the file doesn't exist, the error must wrap [fs.ErrNotExist].
+	Open(name string) (io.ReadCloser, error)
+}
+
+// NewWithSource creates a new migrator for the given database, migration source, and options.
+// The [WithFS], [WithAdditionalFS], [WithGlob], [WithGlobs], and [WithRecursive] options don't apply to a Source,
+// which lists its own files, but files can be excluded with [WithExclude].
+// If source is nil, every operation of the [Migrator] returns an error.
+func NewWithSource(db DB, source Source, options ...ConfigOption) *Migrator {
+	m := newMigrator(db, options)
+	if source == nil && m.err == nil {
+		m.err = errors.New("no migration file system: pass a source to NewWithSource")
+	}
+
+	m.source = source
+	return m
+}
+
+// WithFS configures Flit to load migrations from fsys instead of the file system passed to [New].
+// It lets a list of options be shared by migrators that load migrations from different file systems,
+// such as one per environment or test; pass nil to New for the file system in that case.
+// If neither is given, every operation of the [Migrator] returns an error.
+func WithFS(fsys fs.FS) ConfigOption {
+	return func(c *Migrator) {
+		c.fsys = fsys
+	}
+}
+
+// WithAdditionalFS configures Flit to also load migrations from fsys,
+// such as app-specific migrations in a directory alongside core migrations embedded in a library.
+// It can be passed more than once. The migrations of every file system are ordered together.
+// A file in more than one file system is loaded once if its content is the same in all of them,
+// and every operation that reads its content returns an error naming it otherwise.
+// The copies are compared when the file is read, so operations that only list migrations don't read them.
+// The globs configured by [WithGlob], [WithGlobs], and [WithRecursive] apply to every file system.
+func WithAdditionalFS(fsys fs.FS) ConfigOption {
+	return func(c *Migrator) {
+		c.additionalFS = append(c.additionalFS, fsys)
+	}
+}
+
+// readFile reads the named file from the source.
+func readFile(source Source, name string) ([]byte, error) {
+	f, err := source.Open(name)
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+	return io.ReadAll(f)
+}
+
+// fsSource is the Source used by [New].
+type fsSource struct {
+	fs        fs.FS
+	globs     []string
+	recursive bool
+}
+
+// Names returns the names of the files matching any of the configured globs.
+// If recursive loading is enabled, the globs are matched against the base name of every file in the tree.
+func (s *fsSource) Names() ([]string, error) {
+	var names []string
+	if !s.recursive {
+		for _, glob := range s.globs {
+			matches, err := fs.Glob(s.fs, glob)
+			if err != nil {
+				return nil, err
+			}
+
+			names = append(names, matches...)
+		}
+
+		// remove files matched by more than one glob
+		slices.Sort(names)
+		return slices.Compact(names), nil
+	}
+
+	err := fs.WalkDir(s.fs, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		for _, glob := range s.globs {
+			match, err := path.Match(glob, path.Base(name))
+			if err != nil {
+				return err
+			}
+
+			if match {
+				names = append(names, name)
+				return nil
+			}
+		}
+
+		return nil
+	})
+
+	return names, err
+}
+
+// Open opens the named file in the file system.
+func (s *fsSource) Open(name string) (io.ReadCloser, error) {
+	return s.fs.Open(name)
+}
+
+// mergedSource is the Source used by [New] with [WithAdditionalFS].
+// It lists the files of every source, and opens each file from the sources that have it.
+type mergedSource struct {
+	sources []Source
+}
+
+// Names returns the names of the files in any of the sources.
+// A file in more than one source is listed once.
+// Its content isn't compared until it's opened, so listing doesn't read any file.
+func (s *mergedSource) Names() ([]string, error) {
+	var (
+		names []string
+		seen  = make(map[string]bool)
+	)
+
+	for _, source := range s.sources {
+		list, err := source.Names()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, name := range list {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+
+	return names, nil
+}
+
+// Open reads the named file from every source that has it,
+// and returns an error if its content differs between them.
+func (s *mergedSource) Open(name string) (io.ReadCloser, error) {
+	var data []byte
+	found := false
+	for _, source := range s.sources {
+		d, err := readFile(source, name)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		if found && !bytes.Equal(data, d) {
+			return nil, fmt.Errorf("migration %s differs between file systems", name)
+		}
+
+		data, found = d, true
+	}
+
+	if !found {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
@@ -0,0 +1,163 @@
+package flit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// splitStatements is the default statement splitter.
+// It splits the SQL after every semicolon that ends a line,
+// ignoring semicolons inside single-quoted string literals, PostgreSQL's dollar-quoted strings,
+// "--" comments, and "/* */" comments, which can be nested as in PostgreSQL.
+// Statements that contain only whitespace and comments are dropped.
+func splitStatements(sql string) []string {
+	var (
+		stmts []string
+		start int
+	)
+
+	for i := 0; i < len(sql); i++ {
+		rest := sql[i:]
+		switch {
+		case rest[0] == '\'':
+			i += skipPast(rest[1:], "'")
+		case strings.HasPrefix(rest, "--"):
+			i += skipPast(rest, "\n") - 1
+		case strings.HasPrefix(rest, "/*"):
+			i += blockCommentLength(rest) - 1
+		case rest[0] == '$' && (i == 0 || !isIdentifierByte(sql[i-1])):
+			if tag := dollarTagPattern.FindString(rest); tag != "" {
+				i += len(tag) + skipPast(rest[len(tag):], tag) - 1
+			}
+		case rest[0] == ';' && endsLine(rest[1:]):
+			stmts = appendStatement(stmts, sql[start:i+1])
+			start = i + 1
+		}
+	}
+
+	return appendStatement(stmts, sql[start:])
+}
+
+// dollarTagPattern matches the tag that opens a PostgreSQL dollar-quoted string, such as "$$" or "$body$".
+var dollarTagPattern = regexp.MustCompile(`^\$([A-Za-z_][A-Za-z0-9_]*)?\$`)
+
+// isIdentifierByte reports whether c can be part of an unquoted identifier,
+// in which case a following "$" doesn't open a dollar-quoted string.
+func isIdentifierByte(c byte) bool {
+	return c == '_' || c == '$' || '0' <= c && c <= '9' || 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z'
+}
+
+// skipPast returns the length of s up to and including the first occurrence of end,
+// or the length of s if end doesn't occur.
+func skipPast(s, end string) int {
+	if i := strings.Index(s, end); i >= 0 {
+		return i + len(end)
+	}
+
+	return len(s)
+}
+
+// blockCommentLength returns the length of the "/* */" comment at the start of s, including nested comments,
+// or the length of s if the comment isn't closed.
+func blockCommentLength(s string) int {
+	depth := 0
+	for i := 0; i+1 < len(s); i++ {
+		switch s[i : i+2] {
+		case "/*":
+			depth++
+			i++
+		case "*/":
+			depth--
+			i++
+			if depth == 0 {
+				return i + 1
+			}
+		}
+	}
+
+	return len(s)
+}
+
+// endsLine reports whether s is empty or only whitespace up to the next newline.
+func endsLine(s string) bool {
+	line, _, _ := strings.Cut(s, "\n")
+	return strings.TrimSpace(line) == ""
+}
+
+// appendStatement appends the trimmed statement to stmts unless it is blank.
+func appendStatement(stmts []string, stmt string) []string {
+	if isBlank(stmt) {
+		return stmts
+	}
+
+	return append(stmts, strings.TrimSpace(stmt))
+}
+
+// isBlank reports whether sql contains only whitespace, "--" comments, and "/* */" comments.
+func isBlank(sql string) bool {
+	for {
+		sql = strings.TrimSpace(sql)
+		switch {
+		case sql == "":
+			return true
+		case strings.HasPrefix(sql, "--"):
+			sql = sql[skipPast(sql, "\n"):]
+		case strings.HasPrefix(sql, "/*"):
+			sql = sql[blockCommentLength(sql):]
+		default:
+			return false
+		}
+	}
+}
+
+// ErrExec matches an [*ExecError] with [errors.Is].
+var ErrExec = errors.New("exec failed")
+
+// An ExecError is returned, wrapped with the migration's name, when a statement in a migration fails.
+// It identifies the statement as split by the configured splitter.
+// The driver's error is returned by [errors.Unwrap].
+type ExecError struct {
+	Statement int    // 1-based index of the statement in the migration
+	SQL       string // the statement
+	Err       error  // the driver's error
+}
+
+func (e *ExecError) Error() string {
+	return fmt.Sprintf("statement %d (%s): %v", e.Statement, snippet(e.SQL), e.Err)
+}
+
+func (e *ExecError) Unwrap() error {
+	return e.Err
+}
+
+func (e *ExecError) Is(target error) bool {
+	return target == ErrExec
+}
+
+// snippetLength is the number of characters of a statement included in an [ExecError]'s message.
+const snippetLength = 60
+
+// snippet returns the start of a statement on one line, for error messages.
+func snippet(stmt string) string {
+	s := []rune(strings.Join(strings.Fields(stmt), " "))
+	if len(s) > snippetLength {
+		return string(s[:snippetLength]) + "..."
+	}
+
+	return string(s)
+}
+
+// execScript splits the SQL into statements with the configured splitter and executes them in order.
+// If a statement fails, it returns an [*ExecError].
+func (m *Migrator) execScript(ctx context.Context, ex execer, sql string) error {
+	for i, stmt := range m.split(sql) {
+		if _, err := ex.ExecContext(ctx, stmt); err != nil {
+			return &ExecError{Statement: i + 1, SQL: stmt, Err: err}
+		}
+	}
+
+	return nil
+}
@@ -1,25 +1,61 @@
-// Package sqlitetest provides a test helper to create an in-memory SQLite database.
+// Package sqlitetest provides test helpers to create SQLite databases.
 // It uses the github.com/mattn/go-sqlite3 driver.
 package sqlitetest
 
 import (
+	"crypto/rand"
 	"database/sql"
+	"encoding/hex"
+	"io"
+	"path/filepath"
 	"testing"
 
 	_ "github.com/mattn/go-sqlite3"
 )
 
-func NewDB(t *testing.T) *sql.DB {
+// NewDB creates a new in-memory SQLite database that is deleted when it is closed after the test.
+// Each database has a random name, so databases created by different calls are isolated from each other,
+// while the connections to one database share its cache.
+//
+// Foreign key constraints are enforced, as they are by most other databases,
+// so migrations that violate them fail in tests instead of in production.
+// SQLite doesn't enforce them by default.
+func NewDB(t testing.TB) *sql.DB {
 	t.Helper()
 
-	db, err := sql.Open("sqlite3", "file::memory:?cache=shared")
+	randomBytes := make([]byte, 16)
+	if _, err := io.ReadFull(rand.Reader, randomBytes); err != nil {
+		t.Fatalf("sqlitetest: generate name: %v", err)
+	}
+
+	name := "sqlitetest_" + hex.EncodeToString(randomBytes)
+	return open(t, "file:"+name+"?mode=memory&cache=shared&_foreign_keys=on")
+}
+
+// NewFileDB creates a new SQLite database in a file in a temporary directory,
+// which is deleted after the test, and returns the database and the file's path.
+// Unlike an in-memory database, the file can be opened by other connections and processes,
+// so tests can exercise SQLite's file locking or inspect the file.
+// Foreign key constraints are enforced.
+func NewFileDB(t testing.TB) (*sql.DB, string) {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "sqlitetest.db")
+	return open(t, "file:"+path+"?_foreign_keys=on"), path
+}
+
+// open opens the database described by dsn and closes it after the test.
+func open(t testing.TB, dsn string) *sql.DB {
+	t.Helper()
+
+	db, err := sql.Open("sqlite3", dsn)
 	if err != nil {
 		t.Fatalf("sqlitetest: open database: %v", err)
 	}
 
 	t.Cleanup(func() {
 		if err := db.Close(); err != nil {
-			t.Errorf("sqlitetest: open database: %v", err)
+			t.Errorf("sqlitetest: close database: %v", err)
 		}
 	})
 
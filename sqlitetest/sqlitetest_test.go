@@ -0,0 +1,57 @@
+package sqlitetest_test
+
+import (
+	"database/sql"
+	"os"
+	"testing"
+
+	"github.com/180-studios/flit/sqlitetest"
+)
+
+func TestNewDBIsolated(t *testing.T) {
+	first := sqlitetest.NewDB(t)
+	second := sqlitetest.NewDB(t)
+
+	if _, err := first.Exec("CREATE TABLE data (id NUMERIC PRIMARY KEY)"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := first.Exec("SELECT * FROM data"); err != nil {
+		t.Errorf("expected the table to exist in the first database: %v", err)
+	}
+
+	if _, err := second.Exec("SELECT * FROM data"); err == nil {
+		t.Error("expected the table to not exist in the second database")
+	}
+}
+
+func TestNewDBForeignKeys(t *testing.T) {
+	checkForeignKeys(t, sqlitetest.NewDB(t))
+}
+
+func TestNewFileDB(t *testing.T) {
+	db, path := sqlitetest.NewFileDB(t)
+	checkForeignKeys(t, db)
+
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("expected the database file to exist: %v", err)
+	}
+}
+
+// checkForeignKeys checks that the database enforces foreign key constraints.
+func checkForeignKeys(t *testing.T, db *sql.DB) {
+	t.Helper()
+
+	for _, stmt := range []string{
+		"CREATE TABLE parent (id INTEGER PRIMARY KEY)",
+		"CREATE TABLE child (parent_id INTEGER REFERENCES parent (id))",
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := db.Exec("INSERT INTO child (parent_id) VALUES (1)"); err == nil {
+		t.Error("expected the foreign key constraint to be enforced")
+	}
+}
@@ -0,0 +1,208 @@
+package flit
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Status describes the state of a database's migrations.
+// It is returned by [Migrator.Status].
+type Status struct {
+	// Applied contains the names of applied migrations, ordered by name.
+	Applied []string
+
+	// Pending contains the names of migrations that haven't been applied, ordered by name.
+	Pending []string
+
+	// Dirty contains the names of migrations that failed partway through, ordered by name.
+	// [Migrator.Migrate] refuses to run while any migration is dirty.
+	Dirty []string
+
+	// Orphans contains the sums of applied migrations that no longer exist in the file system.
+	Orphans []string
+
+	// AppliedAt maps the names of applied migrations to the time they were applied.
+	// Migrations recorded by older versions of Flit, which didn't record the time, are missing.
+	AppliedAt map[string]time.Time
+}
+
+// Status reports which migrations have been applied and which are pending.
+// It doesn't apply any migrations or change the database,
+// other than creating the "flits" table if it doesn't exist,
+// or upgrading a table created by an older version of Flit as [Migrator.Migrate] does.
+//
+// Status is guarded the same way as [Migrator.Migrate],
+// so it waits for a concurrent Migrate to finish and reports its result.
+func (m *Migrator) Status(ctx context.Context) (*Status, error) {
+	migrations, err := m.loadMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	status := &Status{AppliedAt: make(map[string]time.Time)}
+	err = m.guarded(ctx, migrations, func(ctx context.Context, conn *sql.Conn) error {
+		records, err := m.getRecords(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		completed := make(map[string]record, len(records))
+		for _, r := range records {
+			completed[r.Sum] = r
+		}
+
+		for _, mig := range migrations {
+			r, ok := completed[mig.Sum]
+			delete(completed, mig.Sum)
+			switch {
+			case ok && r.Dirty:
+				status.Dirty = append(status.Dirty, mig.Name)
+			case ok:
+				status.Applied = append(status.Applied, mig.Name)
+				if r.AppliedAt.Valid {
+					status.AppliedAt[mig.Name] = r.AppliedAt.Time
+				}
+			default:
+				status.Pending = append(status.Pending, mig.Name)
+			}
+		}
+
+		// the remaining sums don't match a migration
+		for sum := range completed {
+			status.Orphans = append(status.Orphans, sum)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	slices.Sort(status.Orphans)
+	return status, nil
+}
+
+// AppliedAt returns the time the named migration was applied.
+// It returns false if the migration hasn't been applied, or is dirty.
+// It returns an error if the migration was recorded by an older version of Flit, which didn't record the time.
+//
+// AppliedAt doesn't change the database, other than creating the "flits" table if it doesn't exist.
+func (m *Migrator) AppliedAt(ctx context.Context, name string) (appliedAt time.Time, ok bool, err error) {
+	migrations, err := m.loadMigrations()
+	if err != nil {
+		return
+	}
+
+	err = m.guarded(ctx, migrations, func(ctx context.Context, conn *sql.Conn) error {
+		var t timestamp
+		err := conn.QueryRowContext(ctx, "SELECT applied_at FROM "+m.quotedTable()+" WHERE sum = "+m.dialect.placeholder(1)+" AND dirty = "+m.dialect.boolean(false)+" AND "+m.inNamespace(2), m.sum(name), m.namespace).Scan(&t)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if !t.Valid {
+			return fmt.Errorf("applied at %s: the time wasn't recorded by the version of Flit that applied it", name)
+		}
+
+		appliedAt, ok = t.Time, true
+		return nil
+	})
+
+	return
+}
+
+// ListApplied returns the names of applied migrations in the order they were applied.
+// Migrations applied at the same time are ordered by name.
+// The names are those recorded when the migrations were applied.
+// Migrations recorded by older versions of Flit, which didn't record names,
+// are named by matching them with the file system, and are omitted if they no longer exist.
+//
+// ListApplied doesn't change the database, other than creating the "flits" table if it doesn't exist.
+func (m *Migrator) ListApplied(ctx context.Context) ([]string, error) {
+	migrations, err := m.loadMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	type named struct {
+		record
+		name string
+	}
+
+	var applied []named
+	err = m.guarded(ctx, migrations, func(ctx context.Context, conn *sql.Conn) error {
+		records, err := m.getRecords(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		sums := bySum(migrations)
+		for _, r := range records {
+			if name, ok := r.name(sums); ok && !r.Dirty {
+				applied = append(applied, named{r, name})
+			}
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	// the migrations applied by each Migrate call are recorded in name order
+	slices.SortFunc(applied, func(a, b named) int {
+		if c := a.AppliedAt.Compare(b.AppliedAt.Time); c != 0 {
+			return c
+		}
+
+		return strings.Compare(a.name, b.name)
+	})
+
+	names := []string{}
+	for _, a := range applied {
+		names = append(names, a.name)
+	}
+
+	return names, nil
+}
+
+// Pending returns the names of migrations that haven't been applied, ordered by name.
+// Unlike [Migrator.Plan], it doesn't verify checksums or check the order of migrations,
+// so it succeeds even when [Migrator.Migrate] would refuse to apply them.
+//
+// Pending doesn't change the database, other than creating the "flits" table if it doesn't exist,
+// or upgrading a table created by an older version of Flit as [Migrator.Migrate] does.
+func (m *Migrator) Pending(ctx context.Context) (pending []string, err error) {
+	migrations, err := m.loadMigrations()
+	if err != nil {
+		return
+	}
+
+	err = m.guarded(ctx, migrations, func(ctx context.Context, conn *sql.Conn) error {
+		completed, err := m.getCompletedMigrations(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, mig := range migrations {
+			if _, ok := completed[mig.Sum]; !ok {
+				pending = append(pending, mig.Name)
+			}
+		}
+
+		return nil
+	})
+
+	return
+}
@@ -0,0 +1,373 @@
+package flit
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// A column is a column added to the configured table after its first version.
+type column struct {
+	name       string
+	definition string
+}
+
+// columns returns the columns added to the configured table after its first version,
+// in the order they were added.
+func (m *Migrator) columns() []column {
+	return []column{
+		// explicitly nullable, since without explicit_defaults_for_timestamp MySQL makes
+		// a table's first TIMESTAMP column NOT NULL and updates it whenever the row is updated
+		{"applied_at", m.dialect.timestampType() + " NULL"},
+		{"checksum", m.sumType()},
+		{"name", "VARCHAR(255)"},
+		{"dirty", m.dirtyType()},
+		{"namespace", "VARCHAR(255) NOT NULL DEFAULT ''"},
+		{"metadata", m.dialect.textType()},
+	}
+}
+
+// dirtyType returns the column type of the dirty column.
+func (m *Migrator) dirtyType() string {
+	return m.dialect.booleanType() + " NOT NULL DEFAULT " + m.dialect.boolean(false)
+}
+
+// sumType returns the column type of hex-encoded hashes computed with the configured hasher.
+func (m *Migrator) sumType() string {
+	return fmt.Sprintf("CHAR(%d)", m.sumLength())
+}
+
+// WithCreateTable configures whether Flit creates the "flits" table, or the table configured by [WithTable],
+// if it doesn't exist, and adds columns to tables created by older versions.
+// The default is true.
+//
+// If create is false, the table must be created in advance, such as by a privileged user,
+// and every operation that reads it returns an error if it doesn't exist or is missing a column.
+// Run a migrator with the default once to create the table, or create it with the same columns.
+func WithCreateTable(create bool) ConfigOption {
+	return func(c *Migrator) {
+		c.createTable = create
+	}
+}
+
+// WithMetadata configures Flit to record metadata about the deployment applying migrations,
+// such as the host name, version, or commit, with every migration it records,
+// so the table answers which deployment applied a migration.
+// The metadata is stored as a JSON object in the table's metadata column,
+// which is added to tables created by older versions.
+// Without this option, or with an empty map, the column is NULL.
+func WithMetadata(metadata map[string]string) ConfigOption {
+	return func(c *Migrator) {
+		if len(metadata) == 0 {
+			c.metadata = sql.NullString{}
+			return
+		}
+
+		// maps of strings always marshal, with their keys sorted
+		data, _ := json.Marshal(metadata)
+		c.metadata = sql.NullString{String: string(data), Valid: true}
+	}
+}
+
+// ensureTable creates the configured table if it doesn't exist.
+// Tables created by older versions are upgraded by adding any missing columns.
+// If table creation is disabled, it only checks that the table has every column.
+// It returns an error if the table was created with a different hasher.
+func (m *Migrator) ensureTable(ctx context.Context, conn *sql.Conn) error {
+	if !m.createTable {
+		if err := m.checkTable(ctx, conn); err != nil {
+			return err
+		}
+
+		return m.checkSumLength(ctx, conn)
+	}
+
+	query, args := m.dialect.createTable(m.quotedTable(), "sum "+m.sumType()+" PRIMARY KEY, name VARCHAR(255), checksum "+m.sumType()+", applied_at "+m.dialect.timestampType()+" NULL DEFAULT CURRENT_TIMESTAMP, dirty "+m.dirtyType()+", namespace VARCHAR(255) NOT NULL DEFAULT '', metadata "+m.dialect.textType())
+	if _, err := conn.ExecContext(ctx, query, args...); err != nil {
+		return fmt.Errorf("create %s table: %w", m.table, err)
+	}
+
+	for _, c := range m.columns() {
+		if err := m.ensureColumn(ctx, conn, c.name, c.definition); err != nil {
+			return err
+		}
+	}
+
+	return m.checkSumLength(ctx, conn)
+}
+
+// checkTable returns an error if the configured table doesn't exist or is missing a column.
+func (m *Migrator) checkTable(ctx context.Context, conn *sql.Conn) error {
+	names := []string{"sum"}
+	for _, c := range m.columns() {
+		names = append(names, c.name)
+	}
+
+	rows, err := conn.QueryContext(ctx, "SELECT "+strings.Join(names, ", ")+" FROM "+m.quotedTable()+" WHERE 1 = 0")
+	if err != nil {
+		return fmt.Errorf("%s table doesn't exist or is missing columns, and table creation is disabled: %w", m.table, err)
+	}
+
+	return rows.Close()
+}
+
+// ensureColumn adds the named column to the configured table if it doesn't exist.
+// The column is probed with a query that selects no rows,
+// which works the same way on every database.
+func (m *Migrator) ensureColumn(ctx context.Context, conn *sql.Conn, name, definition string) error {
+	rows, err := conn.QueryContext(ctx, "SELECT "+name+" FROM "+m.quotedTable()+" WHERE 1 = 0")
+	if err == nil {
+		return rows.Close()
+	}
+
+	if _, err := conn.ExecContext(ctx, m.dialect.addColumn(m.quotedTable(), name, definition)); err != nil {
+		return fmt.Errorf("add %s column %s: %w", m.table, name, err)
+	}
+
+	return nil
+}
+
+// upgradeSums updates rows recorded by older versions of Flit,
+// which computed the sum of a migration from its full path rather than its file name.
+// Only migrations in a subdirectory have different sums, so rows of other migrations aren't touched.
+// The legacy sums are looked up with a single query, and rows are only updated if any are found,
+// so operations that don't change the database don't write to it.
+// Namespaces were added later, so rows in a namespace never have legacy sums.
+func (m *Migrator) upgradeSums(ctx context.Context, conn *sql.Conn, migrations []migration) error {
+	if m.namespace != "" {
+		return nil
+	}
+
+	var (
+		legacy = make(map[string]migration) // migrations by their legacy sums
+		args   []any
+	)
+
+	for _, mig := range migrations {
+		if sum := m.legacySum(mig.Name); sum != mig.Sum {
+			legacy[sum] = mig
+			args = append(args, sum)
+		}
+	}
+
+	if len(args) == 0 {
+		return nil
+	}
+
+	rows, err := conn.QueryContext(ctx, "SELECT sum FROM "+m.quotedTable()+" WHERE sum IN ("+m.dialect.placeholders(len(args))+")", args...)
+	if err != nil {
+		return fmt.Errorf("find legacy sums: %w", err)
+	}
+
+	var found []string
+	for rows.Next() {
+		var sum string
+		if err := rows.Scan(&sum); err != nil {
+			return errors.Join(err, rows.Close())
+		}
+
+		found = append(found, sum)
+	}
+
+	if err := errors.Join(rows.Err(), rows.Close()); err != nil {
+		return fmt.Errorf("find legacy sums: %w", err)
+	}
+
+	for _, sum := range found {
+		mig := legacy[sum]
+		if _, err := conn.ExecContext(ctx, "UPDATE "+m.quotedTable()+" SET sum = "+m.dialect.placeholder(1)+" WHERE sum = "+m.dialect.placeholder(2), mig.Sum, sum); err != nil {
+			return fmt.Errorf("upgrade sum of %s: %w", mig.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// getCompletedMigrations loads the sums of completed migrations from the configured table,
+// mapped to the checksums of their content when they were applied.
+// The checksum is empty if it wasn't recorded.
+// Dirty migrations aren't completed.
+func (m *Migrator) getCompletedMigrations(ctx context.Context, conn *sql.Conn) (completed map[string]string, err error) {
+	rows, err := conn.QueryContext(ctx, "SELECT sum, checksum FROM "+m.quotedTable()+" WHERE dirty = "+m.dialect.boolean(false)+" AND "+m.inNamespace(1), m.namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	completed = make(map[string]string)
+	for rows.Next() {
+		var (
+			sum      string
+			checksum sql.NullString
+		)
+
+		if err := rows.Scan(&sum, &checksum); err != nil {
+			return nil, err
+		}
+
+		completed[sum] = checksum.String
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return
+}
+
+// getDirtyMigrations loads the names of dirty migrations from the configured table,
+// which are migrations that failed partway through.
+func (m *Migrator) getDirtyMigrations(ctx context.Context, conn *sql.Conn) (dirty []string, err error) {
+	rows, err := conn.QueryContext(ctx, "SELECT name FROM "+m.quotedTable()+" WHERE dirty = "+m.dialect.boolean(true)+" AND "+m.inNamespace(1)+" ORDER BY name", m.namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+
+		dirty = append(dirty, name)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return
+}
+
+// A record is a row of the configured table.
+type record struct {
+	Sum       string
+	Name      sql.NullString // NULL in rows recorded by older versions of Flit
+	AppliedAt timestamp
+	Dirty     bool
+}
+
+// name returns the name of the recorded migration.
+// If the row doesn't have a name, the name is found by matching the sum with the given migrations.
+func (r record) name(migrations map[string]migration) (string, bool) {
+	if r.Name.Valid {
+		return r.Name.String, true
+	}
+
+	mig, ok := migrations[r.Sum]
+	return mig.Name, ok
+}
+
+// getRecords loads the rows of the configured table in the configured namespace.
+func (m *Migrator) getRecords(ctx context.Context, conn *sql.Conn) (records []record, err error) {
+	rows, err := conn.QueryContext(ctx, "SELECT sum, name, applied_at, dirty FROM "+m.quotedTable()+" WHERE "+m.inNamespace(1), m.namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var r record
+		if err := rows.Scan(&r.Sum, &r.Name, &r.AppliedAt, &r.Dirty); err != nil {
+			return nil, err
+		}
+
+		records = append(records, r)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return
+}
+
+// getRecordsBySum loads every row of the configured table, mapped by sum.
+func (m *Migrator) getRecordsBySum(ctx context.Context, conn *sql.Conn) (map[string]record, error) {
+	records, err := m.getRecords(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+
+	bySum := make(map[string]record, len(records))
+	for _, r := range records {
+		bySum[r.Sum] = r
+	}
+
+	return bySum, nil
+}
+
+// A timestamp scans a TIMESTAMP column, which drivers return in different ways.
+// For example, the MySQL driver returns text unless the parseTime parameter is set.
+type timestamp struct {
+	time.Time
+	Valid bool // Valid is false if the column is NULL
+}
+
+// timestampLayouts are the text formats a timestamp column is parsed with.
+var timestampLayouts = []string{
+	"2006-01-02 15:04:05.999999999",
+	time.RFC3339Nano,
+}
+
+// Scan implements [sql.Scanner].
+func (t *timestamp) Scan(src any) error {
+	switch src := src.(type) {
+	case nil:
+		*t = timestamp{}
+		return nil
+	case time.Time:
+		*t = timestamp{Time: src, Valid: true}
+		return nil
+	case []byte:
+		return t.parse(string(src))
+	case string:
+		return t.parse(src)
+	}
+
+	return fmt.Errorf("scan timestamp: unsupported type %T", src)
+}
+
+func (t *timestamp) parse(s string) error {
+	for _, layout := range timestampLayouts {
+		if v, err := time.Parse(layout, s); err == nil {
+			*t = timestamp{Time: v, Valid: true}
+			return nil
+		}
+	}
+
+	return fmt.Errorf("scan timestamp: can't parse %q", s)
+}
+
+// verifyChecksums compares the recorded checksum of every applied migration with its current checksum.
+// The recorded checksums are those loaded by getCompletedMigrations, so no query is needed.
+// Migrations recorded without a checksum, by older versions of Flit, can't be verified.
+// Repeatable migrations are expected to change, so they aren't verified.
+func verifyChecksums(completed map[string]string, migrations []migration) error {
+	var errs []error
+	for _, mig := range migrations {
+		checksum, ok := completed[mig.Sum]
+		if !ok || checksum == "" || mig.Repeatable {
+			continue
+		}
+
+		current, err := mig.checksum()
+		if err != nil {
+			return err
+		}
+
+		if current != checksum {
+			errs = append(errs, fmt.Errorf("verify %s: %w", mig.Name, ErrChecksumMismatch))
+		}
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,46 @@
+package flit
+
+import (
+	"bytes"
+	"fmt"
+	"text/template"
+)
+
+// WithTemplateData configures Flit to render every migration file, including down scripts,
+// as a [text/template] with the given data before it is executed.
+// For example, with the data map[string]any{"Schema": "app"},
+// the statement "CREATE TABLE {{.Schema}}.users (id INT)" creates the table app.users.
+// Files without template actions are unchanged.
+//
+// Checksums are computed from the rendered SQL,
+// so databases migrated with different data don't report checksum mismatches against each other,
+// but changing the data for a database that has already been migrated does.
+//
+// The data is inserted into the SQL as is, without quoting or escaping,
+// so it must be trusted and must be valid SQL in the place it's used.
+// Quote identifiers and string literals in the template if they need it.
+func WithTemplateData(data map[string]any) ConfigOption {
+	return func(c *Migrator) {
+		c.templateData = data
+	}
+}
+
+// render executes the named migration file as a template with the configured data.
+// If no data is configured the file is returned unchanged.
+func (m *Migrator) render(name string, data []byte) ([]byte, error) {
+	if m.templateData == nil {
+		return data, nil
+	}
+
+	t, err := template.New(name).Option("missingkey=error").Parse(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("render %s: %w", name, err)
+	}
+
+	var b bytes.Buffer
+	if err := t.Execute(&b, m.templateData); err != nil {
+		return nil, fmt.Errorf("render %s: %w", name, err)
+	}
+
+	return b.Bytes(), nil
+}
@@ -0,0 +1 @@
+INSERT INTO data (id, name) VALUES (1, 'fixture');
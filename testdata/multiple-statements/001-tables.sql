@@ -0,0 +1,12 @@
+-- three tables; one statement each
+CREATE TABLE first (
+  id NUMERIC PRIMARY KEY
+);
+
+CREATE TABLE second (
+  id NUMERIC PRIMARY KEY,
+  name VARCHAR(255) NOT NULL DEFAULT 'not;
+the end;'
+);
+
+CREATE TABLE third (id NUMERIC PRIMARY KEY);
@@ -0,0 +1 @@
+ALTER TABLE data ADD COLUMN name VARCHAR(255);
@@ -0,0 +1 @@
+ALTER TABLE data ADD COLUMN notes VARCHAR(255);
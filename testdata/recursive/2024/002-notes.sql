@@ -0,0 +1 @@
+CREATE TABLE notes (id NUMERIC PRIMARY KEY);
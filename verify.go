@@ -0,0 +1,80 @@
+package flit
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+)
+
+// Verify checks that the database exactly matches the migrations, without applying any.
+// It returns nil if they match, or an error joining one error for every discrepancy:
+// dirty migrations wrap [ErrDirty], pending migrations wrap [ErrPending],
+// applied migrations whose content changed wrap [ErrChecksumMismatch],
+// and applied migrations that no longer exist wrap [ErrOrphanedMigration].
+// Checksums are verified even if [WithChecksumVerification] isn't enabled.
+// Verify is intended as a check before deploying, such as in CI.
+//
+// Verify doesn't change the database, other than creating the "flits" table if it doesn't exist,
+// or upgrading a table created by an older version of Flit as [Migrator.Migrate] does.
+func (m *Migrator) Verify(ctx context.Context) error {
+	migrations, err := m.loadMigrations()
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	err = m.guarded(ctx, migrations, func(ctx context.Context, conn *sql.Conn) error {
+		dirty, err := m.getDirtyMigrations(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, name := range dirty {
+			errs = append(errs, fmt.Errorf("%w: %s failed", ErrDirty, name))
+		}
+
+		completed, err := m.getCompletedMigrations(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		if err := verifyChecksums(completed, migrations); err != nil {
+			errs = append(errs, err)
+		}
+
+		for _, mig := range migrations {
+			checksum, ok := completed[mig.Sum]
+			delete(completed, mig.Sum)
+
+			pending := !ok
+			if ok && mig.Repeatable {
+				current, err := mig.checksum()
+				if err != nil {
+					return err
+				}
+
+				// changed repeatable migrations are applied again
+				pending = checksum != current
+			}
+
+			if pending && !slices.Contains(dirty, mig.Name) {
+				errs = append(errs, fmt.Errorf("%w: %s", ErrPending, mig.Name))
+			}
+		}
+
+		for _, sum := range slices.Sorted(maps.Keys(completed)) {
+			errs = append(errs, fmt.Errorf("%w: %s", ErrOrphanedMigration, sum))
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return err
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,178 @@
+package flit
+
+import (
+	"cmp"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// WithUniqueVersions configures Flit to reject migrations whose names start with the same version number,
+// such as "001-a.sql" and "001-b.sql", because their order depends on the rest of their names,
+// which is easy to get wrong when two developers pick the same number.
+// Every operation that loads migrations returns an error naming both files.
+// Repeatable migrations and migrations whose names don't start with a number aren't checked.
+func WithUniqueVersions() ConfigOption {
+	return func(c *Migrator) {
+		c.uniqueVersions = true
+	}
+}
+
+// WithNoGaps configures Flit to reject migrations whose version numbers don't form a contiguous sequence,
+// such as "0001", "0002", and "0004", which often means a migration was dropped during a merge.
+// Every operation that loads migrations returns an error listing the missing numbers.
+//
+// The check only applies when every migration's name starts with a sequence number below 1,000,000,
+// so it has no effect on migrations named with timestamps.
+// Repeatable migrations aren't checked.
+func WithNoGaps() ConfigOption {
+	return func(c *Migrator) {
+		c.noGaps = true
+	}
+}
+
+// maxSequence is the largest version number [WithNoGaps] treats as a sequence number rather than a timestamp.
+const maxSequence = 999_999
+
+// WithSort configures Flit to order migrations by their names with the given comparison function,
+// which returns a negative number if a is ordered before b, a positive number if it's ordered after,
+// and zero if their order doesn't matter.
+// The order determines the order migrations are applied in, and the order checked by [WithStrictOrdering].
+// By default names are ordered lexically with [strings.Compare], so "01-second.sql" is after "002-first.sql";
+// see [NaturalSort] to compare version numbers numerically.
+func WithSort(compare func(a, b string) int) ConfigOption {
+	return func(c *Migrator) {
+		c.sort = compare
+	}
+}
+
+// WithNumericOrdering configures Flit to order migrations numerically by the version numbers
+// their file names start with, as most people intend when they prefix names with numbers,
+// so "01-second.sql" is applied before "002-first.sql".
+// Names with the same version number, or without one, are ordered lexically.
+// It is shorthand for [WithSort] with [NaturalSort].
+func WithNumericOrdering() ConfigOption {
+	return WithSort(NaturalSort)
+}
+
+// NaturalSort compares migration names by the version numbers their file names start with,
+// so "01-second.sql" is ordered before "002-first.sql" and "9-ninth.sql" before "10-tenth.sql".
+// Names with the same version number, or without one, are compared lexically.
+// Names with directories, such as those loaded with [WithRecursive], are compared one path element at a time,
+// so every migration in "2024/" is still ordered before any in "2025/",
+// and "2024/002-a.sql" is ordered before "2025/001-b.sql".
+// Pass it to [WithSort].
+func NaturalSort(a, b string) int {
+	ae, be := strings.Split(a, "/"), strings.Split(b, "/")
+	for i := range min(len(ae), len(be)) {
+		if c := naturalCompare(ae[i], be[i]); c != 0 {
+			return c
+		}
+	}
+
+	return cmp.Compare(len(ae), len(be))
+}
+
+// naturalCompare compares two path elements by their version numbers, or lexically.
+func naturalCompare(a, b string) int {
+	va, aok := version(a)
+	vb, bok := version(b)
+	if aok && bok && va != vb {
+		return cmp.Compare(va, vb)
+	}
+
+	return strings.Compare(a, b)
+}
+
+// WithCaseInsensitiveOrder configures Flit to order migrations by their names ignoring case,
+// so "a-first.sql" is applied before "B-second.sql" instead of after it.
+// Names that only differ in case are ordered lexically.
+// Names are only compared this way; they are still hashed as they are.
+// It is shorthand for [WithSort] with [CaseInsensitiveSort].
+func WithCaseInsensitiveOrder() ConfigOption {
+	return WithSort(CaseInsensitiveSort)
+}
+
+// CaseInsensitiveSort compares migration names lexically ignoring case,
+// so "a-first.sql" is ordered before "B-second.sql".
+// Names that only differ in case are compared lexically.
+// Pass it to [WithSort].
+func CaseInsensitiveSort(a, b string) int {
+	if c := strings.Compare(strings.ToLower(a), strings.ToLower(b)); c != 0 {
+		return c
+	}
+
+	return strings.Compare(a, b)
+}
+
+// version parses the version number at the start of a migration's base name,
+// such as 1 for "001-first.sql" or 20240102150405 for "20240102150405_first.sql".
+// It reports false if the name doesn't start with a number.
+func version(name string) (uint64, bool) {
+	base := path.Base(name)
+	digits := strings.IndexFunc(base, func(r rune) bool {
+		return r < '0' || r > '9'
+	})
+
+	if digits < 0 {
+		digits = len(base)
+	}
+
+	v, err := strconv.ParseUint(base[:digits], 10, 64)
+	return v, err == nil
+}
+
+// checkDuplicateVersions returns an error if two of the migrations have the same version.
+// Repeatable migrations and migrations without versions are ignored.
+func checkDuplicateVersions(migrations []migration) error {
+	seen := make(map[uint64]string)
+	for _, mig := range migrations {
+		v, ok := version(mig.Name)
+		if !ok || mig.Repeatable {
+			continue
+		}
+
+		if other, ok := seen[v]; ok {
+			return fmt.Errorf("migrations %s and %s have the same version %d", other, mig.Name, v)
+		}
+
+		seen[v] = mig.Name
+	}
+
+	return nil
+}
+
+// checkGaps returns an error listing the version numbers missing from the sequence of migrations.
+// It returns nil if any migration isn't numbered with a sequence number.
+func checkGaps(migrations []migration) error {
+	seen := make(map[uint64]bool)
+	first, last := uint64(maxSequence), uint64(0)
+
+	for _, mig := range migrations {
+		if mig.Repeatable {
+			continue
+		}
+
+		v, ok := version(mig.Name)
+		if !ok || v > maxSequence {
+			return nil
+		}
+
+		seen[v] = true
+		first, last = min(first, v), max(last, v)
+	}
+
+	var missing []string
+	for v := first; v < last; v++ {
+		if !seen[v] {
+			missing = append(missing, strconv.FormatUint(v, 10))
+		}
+	}
+
+	if len(missing) > 0 {
+		return fmt.Errorf("missing migration versions %s", strings.Join(missing, ", "))
+	}
+
+	return nil
+}